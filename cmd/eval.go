@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/GAKiknadze/captcha_service/internal/captcha"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// loadFont загружает и создает шрифт с указанным размером
+func loadFont(size float64) *font.Face {
+	// Парсим шрифт Go Regular
+	ttf, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+
+	// Создаем шрифт с указанным размером
+	face, err := opentype.NewFace(ttf, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return &face
+}
+
+func main() {
+	samples := flag.Int("n", 100, "количество капч на каждый уровень сложности")
+	fontSize := flag.Int("font", 28, "размер шрифта")
+	width := flag.Int("width", 250, "ширина изображения")
+	height := flag.Int("height", 100, "высота изображения")
+	flag.Parse()
+
+	fmt.Println("ОЦЕНКА УСТОЙЧИВОСТИ КАПЧИ К РАСПОЗНАВАНИЮ")
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("Размер: %dx%d, шрифт: %dpt, капч на уровень: %d\n", *width, *height, *fontSize, *samples)
+
+	config := captcha.ImageCaptchaConfig{
+		BackgroundColor: color.White,
+		TextColor:       color.Black,
+		Font:            loadFont(float64(*fontSize)),
+		FontSize:        *fontSize,
+		ImageWidth:      *width,
+		ImageHeight:     *height,
+	}
+
+	// Базовый распознаватель строит шаблоны тем же шрифтом, что и капча
+	solver := captcha.NewTemplateSolver(*loadFont(float64(*fontSize)), "")
+
+	results := captcha.Evaluate(config, solver, *samples)
+
+	fmt.Println()
+	fmt.Printf("%-10s %12s %14s %8s %12s\n", "Уровень", "Распознано", "По символам", "Ошибки", "Время/капча")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, r := range results {
+		var perSample time.Duration
+		if r.Samples > 0 {
+			perSample = (r.TotalDuration / time.Duration(r.Samples)).Round(time.Microsecond)
+		}
+		fmt.Printf("%-10s %11.1f%% %13.1f%% %8d %12s\n",
+			r.Difficulty, r.SolveRate()*100, r.CharAccuracy()*100, r.SolverErrors, perSample)
+	}
+
+	fmt.Println("\nЧем ниже доля распознанных капч, тем устойчивее конфигурация к ботам.")
+}
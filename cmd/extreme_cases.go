@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"image"
 	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
@@ -34,6 +36,30 @@ func loadFont(size float64) *font.Face {
 	return &face
 }
 
+// savePNG сохраняет изображение в PNG-файл
+func savePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// printReport выводит показатели качества отрисовки
+func printReport(report captcha.QualityReport) {
+	fmt.Printf("Обрезано пикселей символов: %.1f\n", report.ClippedPixels)
+	fmt.Printf("Максимальное перекрытие символов: %.1f%%\n", report.MaxOverlap*100)
+	fmt.Printf("Контраст текста и фона: %.2f:1\n", report.Contrast)
+	fmt.Printf("Доля изображения, занятая текстом: %.1f%%\n", report.TextCoverage*100)
+	for _, g := range report.Glyphs {
+		if g.ClippedRatio > 0.01 {
+			fmt.Printf("  символ %q: обрезано %.0f%%, видно %.0f%%\n", g.Char, g.ClippedRatio*100, g.Visible*100)
+		}
+	}
+}
+
 func main() {
 	// Создаем папку для экстремальных тестов
 	testDir := "extreme_tests"
@@ -53,6 +79,9 @@ func main() {
 		fontSize    float64
 		description string
 		expected    string // Ожидаемый результат
+		// Текст не помещается в изображение: проверки качества могут
+		// не пройти, и это не считается ошибкой
+		mayFail bool
 	}{
 		// Случай 1: Максимально длинный текст
 		{
@@ -103,6 +132,7 @@ func main() {
 			fontSize:    12,
 			description: "Минимально возможное изображение для одного символа",
 			expected:    "Символ должен быть виден полностью",
+			mayFail:     true,
 		},
 		// Случай 6: Очень большой шрифт
 		{
@@ -142,7 +172,17 @@ func main() {
 			height:      200,
 			fontSize:    24,
 			description: "Высокое узкое изображение",
-			expected:    "Символы должны быть вертикально центрированы",
+			expected:    "Символы должны расположиться в две строки",
+		},
+		// Случай 9a: Два слова в высоком изображении
+		{
+			name:        "tall_two_words",
+			text:        "SUN DESK",
+			width:       140,
+			height:      160,
+			fontSize:    28,
+			description: "Два слова в изображении выше своей ширины",
+			expected:    "Каждое слово должно занять свою строку",
 		},
 		// Случай 10: Специальные символы и цифры
 		{
@@ -178,6 +218,7 @@ func main() {
 
 	successCount := 0
 	warningCount := 0
+	expectedCount := 0 // Непройденные проверки в случаях, где они ожидаемы
 	failCount := 0
 
 	for _, test := range extremeTests {
@@ -202,34 +243,33 @@ func main() {
 		// Создаем генератор
 		captchaGenerator := captcha.NewImageCaptcha(config)
 
-		// Генерируем капчу
-		captchaImage, err := captchaGenerator.Generate(test.text)
-		if err != nil {
-			fmt.Printf("❌ КРИТИЧЕСКАЯ ОШИБКА: %v\n", err)
-			failCount++
-			continue
-		}
+		// Генерируем капчу вместе с раскладкой символов
+		result := captchaGenerator.Render(test.text)
 
 		// Сохраняем в файл
 		filename := filepath.Join(testDir, fmt.Sprintf("%s.png", test.name))
-		err = os.WriteFile(filename, captchaImage, 0644)
+		err := savePNG(filename, result.Image)
 		if err != nil {
 			fmt.Printf("❌ ОШИБКА СОХРАНЕНИЯ: %v\n", err)
 			failCount++
 			continue
 		}
 
-		// Проверяем размер файла (косвенная проверка)
-		fileInfo, _ := os.Stat(filename)
-		fileSizeKB := float64(fileInfo.Size()) / 1024.0
-
 		// Анализируем результат
-		if fileSizeKB < 1.0 {
-			fmt.Printf("⚠️  ПРЕДУПРЕЖДЕНИЕ: Очень маленький размер файла (%.2f KB)\n", fileSizeKB)
-			fmt.Printf("✅ ТЕХНИЧЕСКИ УСПЕШЕН: файл создан\n")
-			warningCount++
+		report := captcha.Analyze(result.Image, result.Glyphs)
+		printReport(report)
+
+		if err := report.Check(captcha.DefaultQualityThresholds); err != nil {
+			fmt.Printf("⚠️  ПРЕДУПРЕЖДЕНИЕ: %v\n", err)
+			if test.mayFail {
+				fmt.Printf("➖ ОЖИДАЕМО: текст не помещается в изображение\n")
+				expectedCount++
+			} else {
+				fmt.Printf("❌ ПРОВЕРКИ КАЧЕСТВА НЕ ПРОЙДЕНЫ: файл создан\n")
+				warningCount++
+			}
 		} else {
-			fmt.Printf("✅ УСПЕХ: файл создан (%.2f KB)\n", fileSizeKB)
+			fmt.Printf("✅ УСПЕХ: файл создан, проверки качества пройдены\n")
 			successCount++
 		}
 
@@ -249,15 +289,21 @@ func main() {
 	fmt.Println(strings.Repeat("=", 60))
 
 	stressTests := []struct {
-		name   string
-		text   string
-		width  int
-		height int
+		name    string
+		text    string
+		width   int
+		height  int
+		layout  captcha.Layout
+		mayFail bool // Текст не помещается в изображение
 	}{
-		{"stress_1", "ABCDEFGHIJKLMNOP", 200, 60},     // 16 символов в узком изображении
-		{"stress_2", "12345678901234567890", 300, 70}, // 20 цифр
-		{"stress_3", "Aa", 30, 30},                    // Минимальный размер для 2 символов
-		{"stress_4", "TEST", 50, 100},                 // Узкое высокое изображение
+		{"stress_1", "ABCDEFGHIJKLMNOP", 200, 60, captcha.LayoutLine, true},      // 16 символов в узком изображении
+		{"stress_2", "12345678901234567890", 300, 70, captcha.LayoutLine, false}, // 20 цифр
+		{"stress_3", "Aa", 30, 30, captcha.LayoutLine, true},                     // Минимальный размер для 2 символов
+		{"stress_4", "TEST", 50, 100, captcha.LayoutLine, false},                 // Узкое высокое изображение
+		{"stress_5", "UP", 50, 100, captcha.LayoutVertical, false},               // Столбец в узком виджете
+		{"stress_6", "TEST", 50, 100, captcha.LayoutVertical, false},             // Столбец из 4 символов
+		{"stress_7", "UP", 50, 100, captcha.LayoutArc, false},                    // Дуга в узком виджете
+		{"stress_8", "CIRCLE", 120, 120, captcha.LayoutCircle, false},            // Символы по кругу
 	}
 
 	for _, test := range stressTests {
@@ -268,17 +314,27 @@ func main() {
 			FontSize:        18,
 			ImageWidth:      test.width,
 			ImageHeight:     test.height,
+			Layout:          test.layout,
 		}
 
 		captchaGenerator := captcha.NewImageCaptcha(config)
-		captchaImage, err := captchaGenerator.Generate(test.text)
+		result := captchaGenerator.Render(test.text)
 
-		if err != nil {
+		filename := filepath.Join(testDir, fmt.Sprintf("%s.png", test.name))
+		if err := savePNG(filename, result.Image); err != nil {
 			fmt.Printf("❌ Стресс-тест '%s' ПРОВАЛЕН: %v\n", test.name, err)
 			failCount++
+			continue
+		}
+
+		report := captcha.Analyze(result.Image, result.Glyphs)
+		if err := report.Check(captcha.DefaultQualityThresholds); err != nil && test.mayFail {
+			fmt.Printf("➖ Стресс-тест '%s' ОЖИДАЕМО С ПРЕДУПРЕЖДЕНИЕМ: %v\n", test.name, err)
+			expectedCount++
+		} else if err != nil {
+			fmt.Printf("⚠️  Стресс-тест '%s' С ПРЕДУПРЕЖДЕНИЕМ: %v\n", test.name, err)
+			warningCount++
 		} else {
-			filename := filepath.Join(testDir, fmt.Sprintf("%s.png", test.name))
-			os.WriteFile(filename, captchaImage, 0644)
 			fmt.Printf("✅ Стресс-тест '%s' ПРОЙДЕН\n", test.name)
 			successCount++
 		}
@@ -291,22 +347,24 @@ func main() {
 	fmt.Printf("Всего тестов: %d\n", len(extremeTests)+len(stressTests))
 	fmt.Printf("✅ Успешных: %d\n", successCount)
 	fmt.Printf("⚠️  С предупреждениями: %d\n", warningCount)
+	fmt.Printf("➖ С ожидаемыми предупреждениями: %d\n", expectedCount)
 	fmt.Printf("❌ Проваленных: %d\n", failCount)
 
-	if failCount == 0 {
+	// Тест с неожиданным предупреждением не пройден: символы обрезаны или перекрыты
+	passed := failCount == 0 && warningCount == 0
+	if passed {
 		fmt.Println("\n🎉 ВСЕ ЭКСТРЕМАЛЬНЫЕ ТЕСТЫ ПРОЙДЕНЫ!")
 		fmt.Println("Система корректно обрабатывает граничные случаи.")
 	} else {
-		fmt.Printf("\n⚠️  ВНИМАНИЕ: %d тестов не прошли\n", failCount)
+		fmt.Printf("\n⚠️  ВНИМАНИЕ: %d тестов не прошли проверки качества, %d не выполнены\n", warningCount, failCount)
 	}
 
 	fmt.Printf("\nВсе тестовые изображения сохранены в директории: %s\n", testDir)
-	fmt.Println("\nРЕКОМЕНДАЦИИ ПО ВИЗУАЛЬНОЙ ПРОВЕРКЕ:")
-	fmt.Println("1. Проверьте, что ни один символ не обрезан по краям")
-	fmt.Println("2. Убедитесь, что текст читаем даже при экстремальных параметрах")
-	fmt.Println("3. Проверьте, что повороты символов не вызывают наложения")
-	fmt.Println("4. Убедитесь, что длинные тексты правильно центрируются")
-	fmt.Println("5. Проверьте, что система адаптирует межсимвольные интервалы")
+	fmt.Println("\nАВТОМАТИЧЕСКИЕ ПРОВЕРКИ КАЧЕСТВА:")
+	fmt.Printf("1. Обрезано не более %.0f%% площади каждого символа\n", captcha.DefaultQualityThresholds.MaxClippedRatio*100)
+	fmt.Printf("2. Видно не менее %.0f%% площади каждого символа\n", captcha.DefaultQualityThresholds.MinVisible*100)
+	fmt.Printf("3. Соседние символы перекрываются не более чем на %.0f%%\n", captcha.DefaultQualityThresholds.MaxOverlap*100)
+	fmt.Printf("4. Контраст текста и фона не ниже %.1f:1\n", captcha.DefaultQualityThresholds.MinContrast)
 
 	fmt.Println("\nОСОБЕННОСТИ РЕАЛИЗАЦИИ ПОВОРОТА СИМВОЛОВ:")
 	fmt.Println("• Автоматический расчет максимального смещения из-за поворота")
@@ -314,4 +372,8 @@ func main() {
 	fmt.Println("• Центрирование текста с учетом поворотов и смещений")
 	fmt.Println("• Проверка границ для каждого пикселя повернутого символа")
 	fmt.Println("• Автоматическое уменьшение интервалов при нехватке места")
+
+	if !passed {
+		os.Exit(1)
+	}
 }
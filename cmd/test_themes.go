@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GAKiknadze/captcha_service/internal/captcha"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// Пороги различимости
+const (
+	minTextContrast = 4.5 // Минимальный контраст текста и фона по WCAG
+	minNoiseDelta   = 20  // Минимальное различие ΔE между текстом и помехами
+	minNoiseVisible = 10  // Различие ΔE с фоном, начиная с которого пиксель считается помехой
+)
+
+// loadFont загружает и создает шрифт с указанным размером
+func loadFont(size float64) *font.Face {
+	// Парсим шрифт Go Regular
+	ttf, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		panic(err)
+	}
+
+	// Создаем шрифт с указанным размером
+	face, err := opentype.NewFace(ttf, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return &face
+}
+
+// measureColors находит цвета текста и помех на готовом изображении.
+// Цвет текста — медиана пикселей, полностью покрытых символами.
+// Помехи — пиксели вне символов, заметно отличающиеся от фона
+func measureColors(result *captcha.RenderResult, background color.Color) (color.Color, []color.Color) {
+	img := result.Image
+	var channels [3][]int
+	noise := map[color.RGBA]bool{}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := img.RGBAAt(x, y)
+
+			coverage := uint8(0)
+			for _, g := range result.Glyphs {
+				coverage = max(coverage, g.Mask.AlphaAt(x, y).A)
+			}
+
+			switch {
+			case coverage == 255:
+				channels[0] = append(channels[0], int(pixel.R))
+				channels[1] = append(channels[1], int(pixel.G))
+				channels[2] = append(channels[2], int(pixel.B))
+			case coverage == 0 && captcha.ColorDifference(pixel, background) >= minNoiseVisible:
+				noise[pixel] = true
+			}
+		}
+	}
+
+	var median [3]uint8
+	for i, values := range channels {
+		if len(values) > 0 {
+			sort.Ints(values)
+			median[i] = uint8(values[len(values)/2])
+		}
+	}
+
+	colors := make([]color.Color, 0, len(noise))
+	for c := range noise {
+		colors = append(colors, c)
+	}
+	return color.RGBA{R: median[0], G: median[1], B: median[2], A: 255}, colors
+}
+
+// savePNG сохраняет изображение в PNG-файл
+func savePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, img)
+}
+
+// minDelta возвращает наименьшее различие цвета текста с цветами помех
+func minDelta(text color.Color, noise []color.Color, deficiency captcha.ColorDeficiency) float64 {
+	result := math.Inf(1)
+	simulatedText := captcha.SimulateDeficiency(text, deficiency)
+	for _, c := range noise {
+		delta := captcha.ColorDifference(simulatedText, captcha.SimulateDeficiency(c, deficiency))
+		result = math.Min(result, delta)
+	}
+	return result
+}
+
+func main() {
+	// Создаем папку для тестовых капч
+	testDir := "theme_tests"
+	if err := os.MkdirAll(testDir, 0755); err != nil {
+		panic(fmt.Sprintf("Не удалось создать директорию: %v", err))
+	}
+
+	fmt.Println("Тестирование тем оформления при нарушениях цветового зрения")
+	fmt.Println(strings.Repeat("=", 60))
+
+	themes := []captcha.Theme{
+		captcha.ThemeDefault,
+		captcha.ThemeDark,
+		captcha.ThemeHighContrast,
+		captcha.ThemeColorblindSafe,
+	}
+
+	// Нулевое значение — нормальное цветовое зрение
+	deficiencies := []captcha.ColorDeficiency{0, captcha.Protanopia, captcha.Deuteranopia, captcha.Tritanopia}
+
+	successCount := 0
+	failCount := 0
+
+	for _, theme := range themes {
+		fmt.Printf("\nТема: %s\n", theme.Name)
+
+		// Рисуем капчу в теме: различимость проверяется на готовом изображении
+		config := theme.Apply(captcha.ImageCaptchaConfig{
+			Font:        loadFont(28),
+			FontSize:    28,
+			ImageWidth:  250,
+			ImageHeight: 100,
+		})
+		result := captcha.NewImageCaptcha(config).Render("THEME7")
+
+		filename := filepath.Join(testDir, fmt.Sprintf("theme_%s.png", theme.Name))
+		if err := savePNG(filename, result.Image); err != nil {
+			fmt.Printf("❌ ОШИБКА сохранения: %v\n", err)
+			failCount++
+			continue
+		}
+
+		text, noise := measureColors(result, theme.Background)
+		fmt.Printf("Цвет текста на изображении: %v, цветов помех: %d\n", text, len(noise))
+
+		for _, d := range deficiencies {
+			contrast := captcha.ContrastRatio(captcha.SimulateDeficiency(text, d), captcha.SimulateDeficiency(theme.Background, d))
+			noiseDelta := minDelta(text, noise, d)
+
+			ok := contrast >= minTextContrast && noiseDelta >= minNoiseDelta
+			status := "✅"
+			if ok {
+				successCount++
+			} else {
+				status = "❌"
+				failCount++
+			}
+
+			fmt.Printf("%s %-13s контраст %5.2f:1, ΔE текст/помехи %5.1f\n", status, d, contrast, noiseDelta)
+		}
+	}
+
+	// Итоги
+	fmt.Println("\n" + strings.Repeat("=", 50))
+	fmt.Printf("ИТОГИ ТЕСТИРОВАНИЯ:\n")
+	fmt.Printf("Успешных проверок: %d\n", successCount)
+	fmt.Printf("Неудачных проверок: %d\n", failCount)
+
+	if failCount > 0 {
+		fmt.Printf("\n⚠️  Есть проблемы: %d проверок не прошли\n", failCount)
+		os.Exit(1)
+	}
+
+	fmt.Println("\n🎉 ВСЕ ТЕМЫ РАЗЛИЧИМЫ ПРИ НАРУШЕНИЯХ ЦВЕТОВОГО ЗРЕНИЯ!")
+	fmt.Printf("Примеры капч сохранены в директории: %s\n", testDir)
+}
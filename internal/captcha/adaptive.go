@@ -0,0 +1,154 @@
+package captcha
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptivePolicyConfig задает параметры адаптивной политики сложности
+type AdaptivePolicyConfig struct {
+	// Базовый уровень сложности для клиентов без неудачных попыток
+	BaseDifficulty Difficulty
+	// Период полураспада счетчика неудач (по умолчанию 15 минут)
+	HalfLife time.Duration
+	// Пороги счетчика неудач для повышения сложности на 1, 2, 3... уровня
+	// (по умолчанию 2, 4, 7)
+	Thresholds []float64
+}
+
+const defaultFailureHalfLife = 15 * time.Minute
+
+var defaultFailureThresholds = []float64{2, 4, 7}
+
+// Минимальное значение счетчика, ниже которого запись удаляется
+const failureScoreEpsilon = 0.01
+
+type failureRecord struct {
+	score   float64
+	updated time.Time
+}
+
+// AdaptivePolicy отслеживает неудачные попытки по ключу клиента
+// (IP, сессия, аккаунт) и выбирает сложность следующей капчи.
+// Счетчик неудач экспоненциально затухает со временем
+type AdaptivePolicy struct {
+	mu         sync.Mutex
+	base       Difficulty
+	halfLife   time.Duration
+	thresholds []float64
+	records    map[string]*failureRecord
+	now        func() time.Time
+}
+
+func NewAdaptivePolicy(config AdaptivePolicyConfig) *AdaptivePolicy {
+	p := &AdaptivePolicy{
+		base:       config.BaseDifficulty,
+		halfLife:   config.HalfLife,
+		thresholds: config.Thresholds,
+		records:    make(map[string]*failureRecord),
+		now:        time.Now,
+	}
+
+	if p.halfLife <= 0 {
+		p.halfLife = defaultFailureHalfLife
+	}
+	if len(p.thresholds) == 0 {
+		p.thresholds = defaultFailureThresholds
+	}
+
+	return p
+}
+
+// RecordFailure учитывает неудачную попытку клиента
+func (p *AdaptivePolicy) RecordFailure(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	record, ok := p.records[key]
+	if !ok {
+		p.records[key] = &failureRecord{score: 1, updated: now}
+		return
+	}
+	record.score = p.decayed(record, now) + 1
+	record.updated = now
+}
+
+// RecordSuccess учитывает успешную попытку: счетчик неудач уменьшается на единицу
+func (p *AdaptivePolicy) RecordSuccess(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	record, ok := p.records[key]
+	if !ok {
+		return
+	}
+
+	now := p.now()
+	record.score = p.decayed(record, now) - 1
+	record.updated = now
+	if record.score < failureScoreEpsilon {
+		delete(p.records, key)
+	}
+}
+
+// Failures возвращает текущее (с учетом затухания) значение счетчика неудач
+func (p *AdaptivePolicy) Failures(key string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	record, ok := p.records[key]
+	if !ok {
+		return 0
+	}
+	return p.decayed(record, p.now())
+}
+
+// Difficulty выбирает уровень сложности следующей капчи для клиента
+func (p *AdaptivePolicy) Difficulty(key string) Difficulty {
+	score := p.Failures(key)
+
+	difficulty := p.base
+	for _, threshold := range p.thresholds {
+		if score < threshold {
+			break
+		}
+		difficulty++
+	}
+
+	if difficulty > DifficultyExtreme {
+		difficulty = DifficultyExtreme
+	}
+	return difficulty
+}
+
+// Config возвращает конфигурацию ImageCaptcha с пресетом сложности для клиента
+// и случайный код длины, рекомендованной для того же уровня
+func (p *AdaptivePolicy) Config(key string, base ImageCaptchaConfig) (ImageCaptchaConfig, string) {
+	d := p.Difficulty(key)
+	return d.Apply(base), d.Code()
+}
+
+// Cleanup удаляет записи, счетчик которых затух почти до нуля.
+// Рекомендуется вызывать периодически, чтобы ограничить потребление памяти
+func (p *AdaptivePolicy) Cleanup() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for key, record := range p.records {
+		if p.decayed(record, now) < failureScoreEpsilon {
+			delete(p.records, key)
+		}
+	}
+}
+
+// decayed вычисляет значение счетчика с учетом прошедшего времени
+func (p *AdaptivePolicy) decayed(record *failureRecord, now time.Time) float64 {
+	elapsed := now.Sub(record.updated)
+	if elapsed <= 0 {
+		return record.score
+	}
+	return record.score * math.Pow(0.5, float64(elapsed)/float64(p.halfLife))
+}
@@ -0,0 +1,278 @@
+package captcha
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// GlyphLayout описывает символ на готовом изображении
+type GlyphLayout struct {
+	Char   rune
+	Bounds image.Rectangle // Область видимых пикселей символа
+	Mask   *image.Alpha    // Покрытие символа в координатах изображения (после искажения)
+	Area   float64         // Площадь символа без обрезки в пикселях
+}
+
+// RenderResult — отрисованная капча вместе с раскладкой символов
+type RenderResult struct {
+	Image  *image.RGBA
+	Glyphs []GlyphLayout
+}
+
+// Render рисует капчу и возвращает изображение вместе с раскладкой символов
+// для анализа качества (см. Analyze)
+func (c *ImageCaptcha) Render(code string) *RenderResult {
+	s := c.newScene(code)
+	return &RenderResult{
+		Image:  c.render(s, 0),
+		Glyphs: c.glyphLayouts(s),
+	}
+}
+
+// glyphLayouts строит маски покрытия символов сцены так же,
+// как символы попадают на итоговое изображение
+func (c *ImageCaptcha) glyphLayouts(s *scene) []GlyphLayout {
+	bounds := image.Rect(0, 0, c.imageWidth, c.imageHeight)
+	area := c.textArea()
+
+	layouts := make([]GlyphLayout, 0, len(s.glyphs))
+	for _, g := range s.glyphs {
+		// Рисуем символ целиком, без обрезки, на холсте вокруг его настоящего
+		// положения: раскладка может вынести символ далеко за изображение
+		contours, size := c.glyphShape(g)
+		radius := c.glyphRadius(c.glyphCell(g.char, contours), size, g.shear)
+		centerX, centerY := g.x+c.charWidth/2, g.y
+		full := image.NewRGBA(image.Rect(centerX-radius, centerY-radius, centerX+radius+1, centerY+radius+1))
+		c.drawGlyph(full, g, full.Rect)
+
+		// Символ проходит ту же обрезку и то же искажение, что и при отрисовке.
+		// Площадь считаем по искаженному символу без обрезки: искажение
+		// меняет площадь, и сравнивать видимую часть нужно с ней.
+		// Оба изображения получаем за один проход по области символа
+		clipped := full.SubImage(area).(*image.RGBA)
+		inside := area.Inset(interpolationReach)
+		outside := area.Inset(-interpolationReach)
+		region := distortedBounds(s.distortion, full.Rect)
+
+		mask := image.NewAlpha(bounds)
+		visible := image.Rectangle{}
+		total := 0.0
+		for y := region.Min.Y; y < region.Max.Y; y++ {
+			for x := region.Min.X; x < region.Max.X; x++ {
+				sx, sy := s.distortion.source(float64(x), float64(y), 0)
+				a := alpha8(c.sample(full, sx, sy))
+				if a == 0 {
+					continue
+				}
+				total += float64(a) / 255
+				if !image.Pt(x, y).In(bounds) {
+					continue
+				}
+
+				// Обрезанный символ отличается от целого только там,
+				// где интерполяция захватывает край области текста
+				src := image.Pt(int(math.Floor(sx)), int(math.Floor(sy)))
+				if !src.In(outside) {
+					continue
+				}
+				if !src.In(inside) {
+					if a = alpha8(c.sample(clipped, sx, sy)); a == 0 {
+						continue
+					}
+				}
+				mask.Pix[mask.PixOffset(x, y)] = a
+				visible = visible.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+
+		layouts = append(layouts, GlyphLayout{
+			Char:   g.char,
+			Bounds: visible,
+			Mask:   mask,
+			Area:   total,
+		})
+	}
+
+	return layouts
+}
+
+// Наибольшее расстояние от точки до пикселей, которые берет интерполяция
+const interpolationReach = 2
+
+// alpha8 переводит прозрачность цвета в 8 бит так же, как setPixel
+func alpha8(c [4]float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(c[3]))))
+}
+
+// distortedBounds возвращает область, в которую искажение d переносит
+// прямоугольник r. Искажение непрерывно и взаимно однозначно,
+// поэтому достаточно перенести границу прямоугольника
+func distortedBounds(d *distortion, r image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	add := func(x, y int) {
+		tx, ty := d.target(float64(x), float64(y), 0)
+		minX, maxX = math.Min(minX, tx), math.Max(maxX, tx)
+		minY, maxY = math.Min(minY, ty), math.Max(maxY, ty)
+	}
+	for x := r.Min.X; x <= r.Max.X; x++ {
+		add(x, r.Min.Y)
+		add(x, r.Max.Y)
+	}
+	for y := r.Min.Y; y <= r.Max.Y; y++ {
+		add(r.Min.X, y)
+		add(r.Max.X, y)
+	}
+
+	// Запас на интерполяцию и неточность обращения искажения
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY))).Inset(-2)
+}
+
+// GlyphReport — показатели качества одного символа
+type GlyphReport struct {
+	Char          rune
+	ClippedPixels float64 // Площадь символа, не попавшая на изображение
+	ClippedRatio  float64 // Доля обрезанной площади символа
+	Visible       float64 // Доля площади символа, не закрытая обрезкой и следующими символами
+}
+
+// QualityReport — показатели качества отрисованной капчи
+type QualityReport struct {
+	Glyphs        []GlyphReport
+	ClippedPixels float64 // Суммарная обрезанная площадь символов
+	MaxOverlap    float64 // Наибольшая доля перекрытия пары символов
+	Contrast      float64 // Контраст текста и фона по WCAG (1..21)
+	TextCoverage  float64 // Доля изображения, занятая текстом
+}
+
+// Analyze оценивает качество отрисованной капчи по изображению и раскладке символов
+func Analyze(img image.Image, glyphs []GlyphLayout) QualityReport {
+	bounds := img.Bounds()
+	report := QualityReport{Glyphs: make([]GlyphReport, len(glyphs))}
+
+	visible := make([]float64, len(glyphs))  // Площадь символа на изображении
+	unhidden := make([]float64, len(glyphs)) // Площадь, не закрытая следующими символами
+	overlap := make([][]float64, len(glyphs))
+	for i := range overlap {
+		overlap[i] = make([]float64, len(glyphs))
+	}
+
+	var textSum, backgroundSum [4]float64
+	var textPixels, backgroundPixels int
+	alphas := make([]float64, len(glyphs))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for i, g := range glyphs {
+				alphas[i] = float64(g.Mask.AlphaAt(x, y).A) / 255
+				visible[i] += alphas[i]
+			}
+
+			// Символы рисуются по порядку, поэтому каждый следующий закрывает предыдущие
+			union := 0.0
+			for i := len(glyphs) - 1; i >= 0; i-- {
+				unhidden[i] += alphas[i] * (1 - union)
+				union += alphas[i] * (1 - union)
+			}
+
+			for i := range glyphs {
+				if alphas[i] == 0 {
+					continue
+				}
+				for j := i + 1; j < len(glyphs); j++ {
+					overlap[i][j] += min(alphas[i], alphas[j])
+				}
+			}
+
+			pixel := premultiplied(img.At(x, y))
+			switch {
+			case union >= 0.5:
+				textPixels++
+				for k := range textSum {
+					textSum[k] += pixel[k]
+				}
+			case union == 0:
+				backgroundPixels++
+				for k := range backgroundSum {
+					backgroundSum[k] += pixel[k]
+				}
+			}
+		}
+	}
+
+	for i, g := range glyphs {
+		gr := GlyphReport{Char: g.Char}
+		if g.Area > 0 {
+			gr.ClippedPixels = max(0, g.Area-visible[i])
+			gr.ClippedRatio = gr.ClippedPixels / g.Area
+			gr.Visible = unhidden[i] / g.Area
+		}
+		report.Glyphs[i] = gr
+		report.ClippedPixels += gr.ClippedPixels
+
+		for j := i + 1; j < len(glyphs); j++ {
+			smaller := min(visible[i], visible[j])
+			if smaller > 0 {
+				report.MaxOverlap = max(report.MaxOverlap, overlap[i][j]/smaller)
+			}
+		}
+	}
+
+	if textPixels > 0 && backgroundPixels > 0 {
+		for k := range textSum {
+			textSum[k] /= float64(textPixels)
+			backgroundSum[k] /= float64(backgroundPixels)
+		}
+		report.Contrast = contrastRatio(textSum, backgroundSum)
+	}
+	if total := bounds.Dx() * bounds.Dy(); total > 0 {
+		report.TextCoverage = float64(textPixels) / float64(total)
+	}
+
+	return report
+}
+
+// QualityThresholds задает допустимые значения показателей качества.
+// Нулевые значения не проверяются
+type QualityThresholds struct {
+	MaxClippedRatio float64 // Максимальная доля обрезанной площади символа
+	MaxOverlap      float64 // Максимальная доля перекрытия пары символов
+	MinVisible      float64 // Минимальная видимая доля каждого символа
+	MinContrast     float64 // Минимальный контраст текста и фона
+	MinTextCoverage float64 // Минимальная доля изображения, занятая текстом
+	MaxTextCoverage float64 // Максимальная доля изображения, занятая текстом
+}
+
+// DefaultQualityThresholds — пороги, при которых капча остается читаемой
+var DefaultQualityThresholds = QualityThresholds{
+	MaxClippedRatio: 0.05,
+	MaxOverlap:      0.25,
+	MinVisible:      0.7,
+	MinContrast:     3,
+}
+
+// Check проверяет показатели и возвращает ошибку с описанием первого нарушения
+func (r QualityReport) Check(t QualityThresholds) error {
+	for _, g := range r.Glyphs {
+		if t.MaxClippedRatio > 0 && g.ClippedRatio > t.MaxClippedRatio {
+			return fmt.Errorf("captcha: glyph %q clipped by %.0f%%", g.Char, g.ClippedRatio*100)
+		}
+		if t.MinVisible > 0 && g.Visible < t.MinVisible {
+			return fmt.Errorf("captcha: glyph %q only %.0f%% visible", g.Char, g.Visible*100)
+		}
+	}
+	if t.MaxOverlap > 0 && r.MaxOverlap > t.MaxOverlap {
+		return fmt.Errorf("captcha: glyphs overlap by %.0f%%", r.MaxOverlap*100)
+	}
+	if t.MinContrast > 0 && r.Contrast < t.MinContrast {
+		return fmt.Errorf("captcha: text contrast %.2f is below %.2f", r.Contrast, t.MinContrast)
+	}
+	if t.MinTextCoverage > 0 && r.TextCoverage < t.MinTextCoverage {
+		return fmt.Errorf("captcha: text covers %.1f%% of the image, below %.1f%%", r.TextCoverage*100, t.MinTextCoverage*100)
+	}
+	if t.MaxTextCoverage > 0 && r.TextCoverage > t.MaxTextCoverage {
+		return fmt.Errorf("captcha: text covers %.1f%% of the image, above %.1f%%", r.TextCoverage*100, t.MaxTextCoverage*100)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultAnimationDelay = 100 * time.Millisecond
+
+	// Сдвиг фазы волнового искажения между кадрами
+	animationPhaseStep = 0.35
+	// Максимальное дрожание символа между кадрами
+	maxJitterOffset = 2   // логических пикселей
+	maxJitterAngle  = 4.0 // градусов
+)
+
+// generateAnimated кодирует капчу в GIF из нескольких кадров.
+// Расположение символов общее, но в каждом кадре символы слегка
+// смещаются и поворачиваются, а помехи движутся, поэтому ни один
+// кадр в отдельности не читается чисто
+func (c *ImageCaptcha) generateAnimated(s *scene) ([]byte, error) {
+	delay := int(c.animationDelay / (10 * time.Millisecond)) // GIF задает задержку в сотых долях секунды
+	if delay < 1 {
+		delay = 1
+	}
+
+	anim := &gif.GIF{}
+	for frame := 0; frame < c.animationFrames; frame++ {
+		jittered := *s
+		jittered.glyphs = c.jitterGlyphs(s.glyphs)
+		rgba := c.render(&jittered, frame)
+
+		anim.Image = append(anim.Image, c.paletted(rgba))
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// jitterGlyphs возвращает копию расположения символов со случайным дрожанием
+func (c *ImageCaptcha) jitterGlyphs(glyphs []glyph) []glyph {
+	offset := c.px(maxJitterOffset)
+
+	jittered := make([]glyph, len(glyphs))
+	for i, g := range glyphs {
+		g.x += rand.Intn(2*offset+1) - offset
+		g.y += rand.Intn(2*offset+1) - offset
+		g.angle += (rand.Float64()*2 - 1) * maxJitterAngle * math.Pi / 180
+		jittered[i] = g
+	}
+	return jittered
+}
+
+// Порог альфы, ниже которого пиксель GIF считается прозрачным
+const gifAlphaThreshold = 128
+
+// paletted приводит кадр к палитре GIF
+func (c *ImageCaptcha) paletted(rgba *image.RGBA) *image.Paletted {
+	if !c.transparent {
+		paletted := image.NewPaletted(rgba.Bounds(), palette.Plan9)
+		draw.Draw(paletted, paletted.Rect, rgba, rgba.Bounds().Min, draw.Src)
+		return paletted
+	}
+
+	// GIF поддерживает только полностью прозрачные пиксели, поэтому
+	// нулевой цвет палитры делаем прозрачным, а полупрозрачные пиксели
+	// либо отбрасываем, либо делаем непрозрачными. Место под прозрачный цвет
+	// освобождаем, убирая темно-синий (0, 0, 68): рядом с ним в палитре есть
+	// черный и (0, 0, 85). Последний цвет палитры — белый, его оставляем,
+	// иначе белый фон квантуется в серый
+	colors := make(color.Palette, 0, 256)
+	colors = append(colors, color.Transparent, palette.Plan9[0])
+	colors = append(colors, palette.Plan9[2:]...)
+	opaque := colors[1:]
+
+	paletted := image.NewPaletted(rgba.Bounds(), colors)
+	bounds := rgba.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			n := color.NRGBAModel.Convert(rgba.At(x, y)).(color.NRGBA)
+			if n.A < gifAlphaThreshold {
+				paletted.SetColorIndex(x, y, 0)
+				continue
+			}
+			n.A = 255
+			paletted.SetColorIndex(x, y, uint8(opaque.Index(n)+1))
+		}
+	}
+	return paletted
+}
@@ -0,0 +1,230 @@
+package captcha
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AudioCaptchaConfig задает параметры звуковой капчи.
+//
+// Voice — файловая система с записями голоса в формате PCM WAV,
+// по одному файлу на символ: "A.wav", "7.wav" и т.д. Регистр имени
+// не важен, но "A.wav" и "a.wav" вместе считаются ошибкой. Обычно это
+// embed.FS, встроенный в бинарный файл сервиса:
+//
+//	//go:embed voice/*.wav
+//	var voice embed.FS
+//	sub, _ := fs.Sub(voice, "voice")
+//	audio, err := captcha.NewAudioCaptcha(captcha.AudioCaptchaConfig{Voice: sub})
+//
+// Если Voice не задан, используется встроенный набор: синтезированные
+// английские названия букв A-Z и цифр 0-9 (см. voice/gen.go)
+type AudioCaptchaConfig struct {
+	Voice          fs.FS
+	SampleRate     int           // Частота дискретизации результата (по умолчанию 16000 Гц)
+	NoiseLevel     float64       // Амплитуда фонового шума 0..1 (по умолчанию 0.05)
+	MinGap         time.Duration // Минимальная пауза между символами (по умолчанию 300 мс)
+	MaxGap         time.Duration // Максимальная пауза между символами (по умолчанию 800 мс)
+	PitchVariation float64       // Максимальное относительное изменение высоты тона 0..0.5 (по умолчанию 0.1)
+}
+
+// Встроенный набор записей голоса
+//
+//go:embed voice/*.wav
+var defaultVoice embed.FS
+
+const (
+	defaultAudioSampleRate     = 16000
+	defaultAudioNoiseLevel     = 0.05
+	defaultAudioMinGap         = 300 * time.Millisecond
+	defaultAudioMaxGap         = 800 * time.Millisecond
+	defaultAudioPitchVariation = 0.1
+
+	// Наибольшее изменение высоты тона: при больших значениях
+	// запись символа сжимается до нуля и символ пропадает из звука
+	maxAudioPitchVariation = 0.5
+)
+
+// AudioCaptcha озвучивает код по символам для пользователей,
+// которые не могут пройти ImageCaptcha
+type AudioCaptcha struct {
+	samples        map[rune][]float64
+	sampleRate     int
+	noiseLevel     float64
+	minGap         time.Duration
+	maxGap         time.Duration
+	pitchVariation float64
+}
+
+func NewAudioCaptcha(config AudioCaptchaConfig) (*AudioCaptcha, error) {
+	c := &AudioCaptcha{
+		sampleRate:     config.SampleRate,
+		noiseLevel:     config.NoiseLevel,
+		minGap:         config.MinGap,
+		maxGap:         config.MaxGap,
+		pitchVariation: config.PitchVariation,
+	}
+
+	if c.sampleRate == 0 {
+		c.sampleRate = defaultAudioSampleRate
+	}
+	if c.noiseLevel == 0 {
+		c.noiseLevel = defaultAudioNoiseLevel
+	}
+	if c.minGap == 0 {
+		c.minGap = defaultAudioMinGap
+	}
+	if c.maxGap == 0 {
+		c.maxGap = defaultAudioMaxGap
+	}
+	if c.maxGap < c.minGap {
+		c.maxGap = c.minGap
+	}
+	if c.pitchVariation == 0 {
+		c.pitchVariation = defaultAudioPitchVariation
+	}
+	c.pitchVariation = math.Max(0, math.Min(maxAudioPitchVariation, c.pitchVariation))
+
+	voice := config.Voice
+	if voice == nil {
+		sub, err := fs.Sub(defaultVoice, "voice")
+		if err != nil {
+			return nil, fmt.Errorf("captcha: open default voice samples: %w", err)
+		}
+		voice = sub
+	}
+
+	samples, err := loadVoiceSamples(voice, c.sampleRate)
+	if err != nil {
+		return nil, err
+	}
+	c.samples = samples
+
+	return c, nil
+}
+
+// loadVoiceSamples загружает записи символов и приводит их к общей частоте дискретизации
+func loadVoiceSamples(voice fs.FS, sampleRate int) (map[rune][]float64, error) {
+	if voice == nil {
+		return nil, fmt.Errorf("captcha: voice samples are not configured")
+	}
+
+	entries, err := fs.ReadDir(voice, ".")
+	if err != nil {
+		return nil, fmt.Errorf("captcha: read voice samples: %w", err)
+	}
+
+	samples := make(map[rune][]float64)
+	files := make(map[rune]string) // Имя файла, из которого загружен символ
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(path.Ext(name), ".wav") {
+			continue
+		}
+
+		// Имя файла без расширения должно состоять из одного символа
+		base := strings.TrimSuffix(name, path.Ext(name))
+		ch, size := utf8.DecodeRuneInString(base)
+		if size == 0 || size != len(base) {
+			continue
+		}
+
+		// Символы ищутся без учета регистра, поэтому "A.wav" и "a.wav"
+		// незаметно заменяли бы друг друга
+		key := unicode.ToUpper(ch)
+		if other, ok := files[key]; ok {
+			return nil, fmt.Errorf("captcha: voice samples %s and %s are for the same character %q", other, name, key)
+		}
+		files[key] = name
+
+		data, err := fs.ReadFile(voice, name)
+		if err != nil {
+			return nil, fmt.Errorf("captcha: read voice sample %s: %w", name, err)
+		}
+		sample, rate, err := decodeWAV(data)
+		if err != nil {
+			return nil, fmt.Errorf("captcha: decode voice sample %s: %w", name, err)
+		}
+
+		samples[key] = resample(sample, float64(sampleRate)/float64(rate))
+	}
+
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("captcha: no voice samples found")
+	}
+
+	return samples, nil
+}
+
+func (c *AudioCaptcha) Generate(code string) ([]byte, error) {
+	// Проверяем, что для всех символов есть записи
+	for _, ch := range code {
+		if _, ok := c.samples[unicode.ToUpper(ch)]; !ok {
+			return nil, fmt.Errorf("captcha: no voice sample for %q", ch)
+		}
+	}
+
+	var out []float64
+
+	// Начальная пауза
+	out = append(out, make([]float64, c.randomGap())...)
+
+	for _, ch := range code {
+		sample := c.samples[unicode.ToUpper(ch)]
+
+		// Случайное изменение высоты тона через передискретизацию
+		pitch := 1 + (rand.Float64()*2-1)*c.pitchVariation
+		voiced := resample(sample, 1/pitch)
+
+		// Случайная громкость символа
+		volume := 0.8 + rand.Float64()*0.2
+		for _, s := range voiced {
+			out = append(out, s*volume)
+		}
+
+		// Случайная пауза после символа
+		out = append(out, make([]float64, c.randomGap())...)
+	}
+
+	c.addNoise(out)
+
+	return encodeWAV(out, c.sampleRate), nil
+}
+
+// randomGap возвращает длину случайной паузы в сэмплах
+func (c *AudioCaptcha) randomGap() int {
+	gap := c.minGap
+	if c.maxGap > c.minGap {
+		gap += time.Duration(rand.Int63n(int64(c.maxGap - c.minGap)))
+	}
+	return int(gap.Seconds() * float64(c.sampleRate))
+}
+
+// addNoise накладывает фоновый шум: отфильтрованный белый шум
+// с медленно меняющейся амплитудой и тихий гул
+func (c *AudioCaptcha) addNoise(samples []float64) {
+	hum := 80 + rand.Float64()*120 // Частота гула в Гц
+	phase := rand.Float64() * 2 * math.Pi
+	filtered := 0.0
+
+	for i := range samples {
+		t := float64(i) / float64(c.sampleRate)
+
+		// Простой фильтр нижних частот делает шум менее резким
+		filtered = filtered*0.7 + (rand.Float64()*2-1)*0.3
+		envelope := 0.75 + 0.25*math.Sin(2*math.Pi*0.5*t+phase)
+
+		noise := filtered*envelope + 0.3*math.Sin(2*math.Pi*hum*t+phase)
+		samples[i] += noise * c.noiseLevel
+	}
+}
+
+var _ Captcha = (*AudioCaptcha)(nil)
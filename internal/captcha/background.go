@@ -0,0 +1,297 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+)
+
+// Background рисует фон капчи. Фон генерируется заново для каждой капчи,
+// scale — масштаб изображения (см. ImageCaptchaConfig.Scale)
+type Background interface {
+	Draw(img *image.RGBA, scale float64)
+}
+
+// Цвета фонов по умолчанию: генераторы, созданные нулевым значением,
+// рисуют светлый фон, на котором читается текст темы по умолчанию
+var (
+	defaultBackgroundLight = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	defaultBackgroundDark  = color.RGBA{0xd8, 0xd8, 0xd8, 0xff}
+)
+
+// colorOr возвращает c или def, если цвет не задан
+func colorOr(c, def color.Color) color.Color {
+	if c == nil {
+		return def
+	}
+	return c
+}
+
+// LinearGradient — линейный градиент между двумя цветами.
+// Незаданные цвета заменяются светлыми цветами по умолчанию
+type LinearGradient struct {
+	From, To    color.Color
+	Angle       float64 // Направление градиента в градусах (0 — слева направо)
+	RandomAngle bool    // Выбирать направление случайно для каждой капчи
+}
+
+func (b LinearGradient) Draw(img *image.RGBA, scale float64) {
+	angle := b.Angle * math.Pi / 180
+	if b.RandomAngle {
+		angle = rand.Float64() * 2 * math.Pi
+	}
+
+	bounds := img.Bounds()
+	w := float64(bounds.Dx())
+	h := float64(bounds.Dy())
+	sin, cos := math.Sincos(angle)
+
+	// Проекция углов изображения на направление градиента задает его начало и конец
+	half := (math.Abs(w*cos) + math.Abs(h*sin)) / 2
+	from := premultiplied(colorOr(b.From, defaultBackgroundLight))
+	to := premultiplied(colorOr(b.To, defaultBackgroundDark))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			proj := (float64(x-bounds.Min.X)-w/2)*cos + (float64(y-bounds.Min.Y)-h/2)*sin
+			t := 0.5
+			if half > 0 {
+				t = (proj + half) / (2 * half)
+			}
+			setPixel(img, x, y, lerpColor(from, to, t))
+		}
+	}
+}
+
+// RadialGradient — радиальный градиент от центра к краям.
+// Незаданные цвета заменяются светлыми цветами по умолчанию
+type RadialGradient struct {
+	Inner, Outer color.Color
+	RandomCenter bool // Смещать центр случайно в пределах средней половины изображения
+}
+
+func (b RadialGradient) Draw(img *image.RGBA, scale float64) {
+	bounds := img.Bounds()
+	w := float64(bounds.Dx())
+	h := float64(bounds.Dy())
+
+	cx, cy := w/2, h/2
+	if b.RandomCenter {
+		cx = w/4 + rand.Float64()*w/2
+		cy = h/4 + rand.Float64()*h/2
+	}
+
+	// Радиус — расстояние до самого дальнего угла
+	radius := math.Max(math.Hypot(cx, cy), math.Hypot(w-cx, h-cy))
+	radius = math.Max(radius, math.Max(math.Hypot(w-cx, cy), math.Hypot(cx, h-cy)))
+	inner := premultiplied(colorOr(b.Inner, defaultBackgroundLight))
+	outer := premultiplied(colorOr(b.Outer, defaultBackgroundDark))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := math.Hypot(float64(x-bounds.Min.X)-cx, float64(y-bounds.Min.Y)-cy)
+			setPixel(img, x, y, lerpColor(inner, outer, d/radius))
+		}
+	}
+}
+
+// NoiseTexture — процедурная текстура на основе шума Перлина.
+// Незаданные цвета заменяются светлыми цветами по умолчанию
+type NoiseTexture struct {
+	From, To    color.Color
+	FeatureSize float64 // Размер деталей текстуры в логических пикселях (по умолчанию 20)
+	Octaves     int     // Количество октав шума (по умолчанию 3)
+}
+
+func (b NoiseTexture) Draw(img *image.RGBA, scale float64) {
+	featureSize := b.FeatureSize
+	if featureSize <= 0 {
+		featureSize = 20
+	}
+	octaves := b.Octaves
+	if octaves <= 0 {
+		octaves = 3
+	}
+
+	p := newPerlin()
+	from := premultiplied(colorOr(b.From, defaultBackgroundLight))
+	to := premultiplied(colorOr(b.To, defaultBackgroundDark))
+	bounds := img.Bounds()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Суммируем октавы с удвоением частоты и уменьшением амплитуды
+			value, amplitude, total := 0.0, 1.0, 0.0
+			frequency := 1 / (featureSize * scale)
+			for o := 0; o < octaves; o++ {
+				value += p.noise(float64(x)*frequency, float64(y)*frequency) * amplitude
+				total += amplitude
+				amplitude /= 2
+				frequency *= 2
+			}
+
+			// Шум лежит примерно в [-1, 1], приводим к [0, 1]
+			t := (value/total + 1) / 2
+			setPixel(img, x, y, lerpColor(from, to, t))
+		}
+	}
+}
+
+// RandomGrid — сетка со случайным шагом, смещением и наклоном.
+// Незаданные цвета заменяются светлыми цветами по умолчанию
+type RandomGrid struct {
+	Background, Line color.Color
+	MinStep, MaxStep int     // Шаг сетки в логических пикселях (по умолчанию 8..16)
+	MaxTilt          float64 // Максимальный наклон сетки в градусах
+}
+
+func (b RandomGrid) Draw(img *image.RGBA, scale float64) {
+	minStep, maxStep := b.MinStep, b.MaxStep
+	if minStep <= 0 {
+		minStep = 8
+	}
+	if maxStep < minStep {
+		maxStep = max(minStep, 16)
+	}
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(colorOr(b.Background, defaultBackgroundLight)), image.Point{}, draw.Src)
+
+	step := float64(minStep+rand.Intn(maxStep-minStep+1)) * scale
+	offsetX := rand.Float64() * step
+	offsetY := rand.Float64() * step
+	tilt := (rand.Float64()*2 - 1) * b.MaxTilt * math.Pi / 180
+	sin, cos := math.Sincos(tilt)
+	thickness := math.Max(1, scale)
+	line := premultiplied(colorOr(b.Line, defaultBackgroundDark))
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Координаты в повернутой системе сетки
+			u := float64(x)*cos + float64(y)*sin + offsetX
+			v := -float64(x)*sin + float64(y)*cos + offsetY
+			if math.Mod(math.Abs(u), step) < thickness || math.Mod(math.Abs(v), step) < thickness {
+				blendPixel(img, x, y, line)
+			}
+		}
+	}
+}
+
+// ImageBackground берет случайный фрагмент из набора изображений.
+// Изображения меньше капчи растягиваются
+type ImageBackground struct {
+	images []*image.RGBA
+}
+
+func NewImageBackground(images ...image.Image) *ImageBackground {
+	b := &ImageBackground{}
+	for _, src := range images {
+		rgba := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(rgba, rgba.Rect, src, src.Bounds().Min, draw.Src)
+		b.images = append(b.images, rgba)
+	}
+	return b
+}
+
+func (b *ImageBackground) Draw(img *image.RGBA, scale float64) {
+	if len(b.images) == 0 {
+		return
+	}
+
+	src := b.images[rand.Intn(len(b.images))]
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Растягиваем источник, если он меньше изображения капчи
+	zoom := math.Max(1, math.Max(float64(w)/float64(src.Rect.Dx()), float64(h)/float64(src.Rect.Dy())))
+	srcW := int(float64(w) / zoom)
+	srcH := int(float64(h) / zoom)
+
+	// Случайное положение фрагмента
+	offsetX := rand.Intn(src.Rect.Dx() - srcW + 1)
+	offsetY := rand.Intn(src.Rect.Dy() - srcH + 1)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := float64(offsetX) + float64(x)/zoom
+			sy := float64(offsetY) + float64(y)/zoom
+			setPixel(img, bounds.Min.X+x, bounds.Min.Y+y, sampleBilinear(src, sx, sy))
+		}
+	}
+}
+
+// lerpColor линейно интерполирует между двумя цветами
+func lerpColor(from, to [4]float64, t float64) [4]float64 {
+	t = math.Max(0, math.Min(1, t))
+	var out [4]float64
+	for i := range out {
+		out[i] = from[i] + (to[i]-from[i])*t
+	}
+	return out
+}
+
+// perlin — классический двумерный градиентный шум Перлина со случайной перестановкой
+type perlin struct {
+	perm [512]int
+}
+
+func newPerlin() *perlin {
+	p := &perlin{}
+	order := rand.Perm(256)
+	for i := 0; i < 512; i++ {
+		p.perm[i] = order[i%256]
+	}
+	return p
+}
+
+func (p *perlin) noise(x, y float64) float64 {
+	xi := int(math.Floor(x)) & 255
+	yi := int(math.Floor(y)) & 255
+	xf := x - math.Floor(x)
+	yf := y - math.Floor(y)
+
+	u := fade(xf)
+	v := fade(yf)
+
+	aa := p.perm[p.perm[xi]+yi]
+	ab := p.perm[p.perm[xi]+yi+1]
+	ba := p.perm[p.perm[xi+1]+yi]
+	bb := p.perm[p.perm[xi+1]+yi+1]
+
+	x1 := lerp(gradient(aa, xf, yf), gradient(ba, xf-1, yf), u)
+	x2 := lerp(gradient(ab, xf, yf-1), gradient(bb, xf-1, yf-1), u)
+	return lerp(x1, x2, v)
+}
+
+// fade — сглаживающая кривая 6t^5 - 15t^4 + 10t^3
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+// gradient возвращает скалярное произведение псевдослучайного градиента и смещения
+func gradient(hash int, x, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	default:
+		return -y
+	}
+}
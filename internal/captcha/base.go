@@ -1,5 +1,19 @@
 package captcha
 
+import "math/rand"
+
 type Captcha interface {
 	Generate(code string) ([]byte, error)
 }
+
+// Алфавит кода без легко путаемых символов (0/O, 1/I/L)
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// RandomCode генерирует случайный код заданной длины
+func RandomCode(length int) string {
+	code := make([]byte, length)
+	for i := range code {
+		code[i] = codeAlphabet[rand.Intn(len(codeAlphabet))]
+	}
+	return string(code)
+}
@@ -0,0 +1,154 @@
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand"
+)
+
+// ClickCaptchaConfig задает параметры капчи с выбором символов
+type ClickCaptchaConfig struct {
+	Length    int     // Длина случайного кода в NewChallenge (по умолчанию 4)
+	Tolerance float64 // Допустимый промах мимо символа в логических пикселях (по умолчанию 5)
+}
+
+const (
+	defaultClickLength    = 4
+	defaultClickTolerance = 5.0
+)
+
+// ClickTarget — символ, по которому нужно щелкнуть
+type ClickTarget struct {
+	Char   rune
+	Bounds image.Rectangle // Область видимых пикселей символа на изображении
+}
+
+// ClickChallenge — изображение с разбросанными символами и символы
+// в том порядке, в котором по ним нужно щелкнуть
+type ClickChallenge struct {
+	Image   []byte // PNG
+	Order   string // Символы в порядке щелчков, показываются пользователю
+	Targets []ClickTarget
+}
+
+// ClickCaptcha разбрасывает символы кода по изображению, поворачивая их
+// как ImageCaptcha, и просит щелкнуть по ним в порядке следования в коде.
+// Всегда возвращает неподвижное PNG-изображение, даже если в ImageCaptcha
+// включена анимация: области символов должны совпадать с изображением.
+// Если в ImageCaptcha не задана проверка качества, используется
+// DefaultQualityThresholds, чтобы символы не перекрывались и не обрезались
+type ClickCaptcha struct {
+	image     *ImageCaptcha
+	length    int
+	tolerance int
+}
+
+func NewClickCaptcha(image *ImageCaptcha, config ClickCaptchaConfig) *ClickCaptcha {
+	// Копия генератора с раскладкой, разбрасывающей символы
+	scatter := *image
+	scatter.textLayout = LayoutScatter
+	scatter.crowded = false
+	if scatter.qualityGuard == nil {
+		thresholds := DefaultQualityThresholds
+		scatter.qualityGuard = &thresholds
+	}
+
+	c := &ClickCaptcha{
+		image:  &scatter,
+		length: config.Length,
+	}
+
+	if c.length <= 0 {
+		c.length = defaultClickLength
+	}
+	tolerance := config.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultClickTolerance
+	}
+	c.tolerance = image.px(tolerance)
+
+	return c
+}
+
+// Generate отрисовывает символы кода в случайных местах изображения
+func (c *ClickCaptcha) Generate(code string) ([]byte, error) {
+	challenge, err := c.Challenge(code)
+	if err != nil {
+		return nil, err
+	}
+	return challenge.Image, nil
+}
+
+// NewChallenge генерирует случайный код из неповторяющихся символов
+// и возвращает задание для него
+func (c *ClickCaptcha) NewChallenge() (*ClickChallenge, error) {
+	code := make([]byte, min(c.length, len(codeAlphabet)))
+	for i, j := range rand.Perm(len(codeAlphabet))[:len(code)] {
+		code[i] = codeAlphabet[j]
+	}
+	return c.Challenge(string(code))
+}
+
+// Challenge отрисовывает символы кода и возвращает изображение вместе
+// с областями символов в порядке кода. Пробелы в коде пропускаются
+func (c *ClickCaptcha) Challenge(code string) (*ClickChallenge, error) {
+	s, err := c.image.newCheckedScene(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сцена, прошедшая проверку качества, уже отрисована
+	if s.frame == nil {
+		s.frame, s.layouts = c.image.render(s, 0), c.image.glyphLayouts(s)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, s.frame); err != nil {
+		return nil, err
+	}
+
+	layouts := s.layouts
+	challenge := &ClickChallenge{
+		Image:   buf.Bytes(),
+		Targets: make([]ClickTarget, len(layouts)),
+	}
+	order := make([]rune, len(layouts))
+	for i, g := range layouts {
+		challenge.Targets[i] = ClickTarget{Char: g.Char, Bounds: g.Bounds}
+		order[i] = g.Char
+	}
+	challenge.Order = string(order)
+
+	return challenge, nil
+}
+
+// Verify проверяет щелчки пользователя: их должно быть столько же, сколько
+// символов, и каждый должен попасть в область своего символа с допуском
+// Tolerance. Одинаковые символы взаимозаменяемы: пользователь не может
+// знать, какой из них идет в коде первым. Координаты щелчков задаются
+// в пикселях изображения
+func (c *ClickCaptcha) Verify(targets []ClickTarget, clicks []image.Point) bool {
+	if len(clicks) != len(targets) || len(targets) == 0 {
+		return false
+	}
+
+	used := make([]bool, len(targets))
+	for i, click := range clicks {
+		hit := -1
+		for j, target := range targets {
+			if !used[j] && target.Char == targets[i].Char && !target.Bounds.Empty() &&
+				click.In(target.Bounds.Inset(-c.tolerance)) {
+				hit = j
+				break
+			}
+		}
+		if hit < 0 {
+			return false
+		}
+		used[hit] = true
+	}
+	return true
+}
+
+var _ Captcha = (*ClickCaptcha)(nil)
@@ -0,0 +1,108 @@
+package captcha
+
+import (
+	"image/color"
+	"math"
+)
+
+// ColorDeficiency — вид нарушения цветового зрения
+type ColorDeficiency int
+
+const (
+	Protanopia ColorDeficiency = iota + 1
+	Deuteranopia
+	Tritanopia
+)
+
+func (d ColorDeficiency) String() string {
+	switch d {
+	case Protanopia:
+		return "protanopia"
+	case Deuteranopia:
+		return "deuteranopia"
+	case Tritanopia:
+		return "tritanopia"
+	default:
+		return "normal"
+	}
+}
+
+// Матрицы моделирования дихроматии в линейном RGB (Machado, Oliveira, Fernandes, 2009)
+var deficiencyMatrices = map[ColorDeficiency][3][3]float64{
+	Protanopia: {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	Deuteranopia: {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	Tritanopia: {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// SimulateDeficiency возвращает цвет так, как его видит человек с нарушением цветового зрения
+func SimulateDeficiency(c color.Color, d ColorDeficiency) color.Color {
+	m, ok := deficiencyMatrices[d]
+	if !ok {
+		return c
+	}
+
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	lin := [3]float64{
+		linearize(float64(n.R) / 255),
+		linearize(float64(n.G) / 255),
+		linearize(float64(n.B) / 255),
+	}
+
+	var out [3]uint8
+	for i := range out {
+		v := m[i][0]*lin[0] + m[i][1]*lin[1] + m[i][2]*lin[2]
+		out[i] = uint8(math.Round(delinearize(math.Max(0, math.Min(1, v))) * 255))
+	}
+
+	return color.NRGBA{R: out[0], G: out[1], B: out[2], A: n.A}
+}
+
+// ColorDifference возвращает цветовое различие двух цветов ΔE (CIE76) в пространстве Lab.
+// Различие около 2 едва заметно, больше 20 — цвета легко различимы
+func ColorDifference(a, b color.Color) float64 {
+	la, aa, ba := toLab(a)
+	lb, ab, bb := toLab(b)
+	return math.Sqrt((la-lb)*(la-lb) + (aa-ab)*(aa-ab) + (ba-bb)*(ba-bb))
+}
+
+// toLab переводит цвет sRGB в пространство CIE Lab (точка белого D65)
+func toLab(c color.Color) (float64, float64, float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r := linearize(float64(n.R) / 255)
+	g := linearize(float64(n.G) / 255)
+	b := linearize(float64(n.B) / 255)
+
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// delinearize переводит линейную компоненту (0..1) обратно в sRGB
+func delinearize(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
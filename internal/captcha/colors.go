@@ -0,0 +1,181 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// GlyphColors задает случайные цвета символов. Цвет выбирается из палитры,
+// а если она пуста — из диапазона HSL. Generate гарантирует минимальный
+// контраст символа с фоном под ним: неподходящие цвета отбрасываются,
+// а если подходящий не найден, последний цвет осветляется или затемняется
+type GlyphColors struct {
+	Palette []color.Color
+
+	// Диапазон HSL: оттенок в градусах 0..360, насыщенность и светлота 0..1.
+	// Если границы не заданы, используется весь диапазон оттенков,
+	// насыщенность 0.5..1 и светлота 0.2..0.8
+	HueMin, HueMax               float64
+	SaturationMin, SaturationMax float64
+	LightnessMin, LightnessMax   float64
+
+	// Минимальный контраст по WCAG (по умолчанию 4.5)
+	MinContrast float64
+}
+
+const (
+	defaultGlyphMinContrast = 4.5
+	// Количество случайных цветов, которые пробуются до корректировки
+	maxGlyphColorAttempts = 20
+)
+
+// pick выбирает цвет с контрастом не ниже минимального относительно фона
+func (gc *GlyphColors) pick(background [4]float64) color.Color {
+	minContrast := gc.MinContrast
+	if minContrast <= 0 {
+		minContrast = defaultGlyphMinContrast
+	}
+
+	var candidate color.Color
+	for attempt := 0; attempt < maxGlyphColorAttempts; attempt++ {
+		candidate = gc.random()
+		if contrastRatio(premultiplied(candidate), background) >= minContrast {
+			return candidate
+		}
+	}
+
+	return adjustContrast(candidate, background, minContrast)
+}
+
+// random возвращает случайный цвет из палитры или диапазона HSL
+func (gc *GlyphColors) random() color.Color {
+	if len(gc.Palette) > 0 {
+		return gc.Palette[rand.Intn(len(gc.Palette))]
+	}
+
+	hueMin, hueMax := gc.HueMin, gc.HueMax
+	if hueMax <= hueMin {
+		hueMin, hueMax = 0, 360
+	}
+	satMin, satMax := gc.SaturationMin, gc.SaturationMax
+	if satMax <= satMin {
+		satMin, satMax = 0.5, 1
+	}
+	lightMin, lightMax := gc.LightnessMin, gc.LightnessMax
+	if lightMax <= lightMin {
+		lightMin, lightMax = 0.2, 0.8
+	}
+
+	return hslColor(
+		hueMin+rand.Float64()*(hueMax-hueMin),
+		satMin+rand.Float64()*(satMax-satMin),
+		lightMin+rand.Float64()*(lightMax-lightMin),
+	)
+}
+
+// adjustContrast осветляет или затемняет цвет, пока контраст с фоном
+// не достигнет минимального. Направление выбирается так, чтобы
+// достичь большего контраста
+func adjustContrast(c color.Color, background [4]float64, minContrast float64) color.Color {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	target := color.NRGBA{A: n.A}
+	if contrastRatio(premultiplied(color.White), background) > contrastRatio(premultiplied(color.Black), background) {
+		target = color.NRGBA{R: 255, G: 255, B: 255, A: n.A}
+	}
+
+	for step := 1; step <= 20; step++ {
+		t := float64(step) / 20
+		adjusted := color.NRGBA{
+			R: uint8(math.Round(float64(n.R) + (float64(target.R)-float64(n.R))*t)),
+			G: uint8(math.Round(float64(n.G) + (float64(target.G)-float64(n.G))*t)),
+			B: uint8(math.Round(float64(n.B) + (float64(target.B)-float64(n.B))*t)),
+			A: n.A,
+		}
+		if contrastRatio(premultiplied(adjusted), background) >= minContrast {
+			return adjusted
+		}
+	}
+
+	return target
+}
+
+// hslColor переводит цвет из HSL в RGB
+func hslColor(h, s, l float64) color.NRGBA {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	chroma := (1 - math.Abs(2*l-1)) * s
+	x := chroma * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - chroma/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = chroma, x, 0
+	case h < 120:
+		r, g, b = x, chroma, 0
+	case h < 180:
+		r, g, b = 0, chroma, x
+	case h < 240:
+		r, g, b = 0, x, chroma
+	case h < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	return color.NRGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
+
+// averageColor возвращает средний цвет области изображения
+func averageColor(img *image.RGBA, area image.Rectangle) [4]float64 {
+	area = area.Intersect(img.Rect)
+	var sum [4]float64
+	if area.Empty() {
+		return sum
+	}
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			p := pixelAt(img, x, y)
+			for k := range sum {
+				sum[k] += p[k]
+			}
+		}
+	}
+
+	n := float64(area.Dx() * area.Dy())
+	for k := range sum {
+		sum[k] /= n
+	}
+	return sum
+}
+
+// assignGlyphColors выбирает цвет каждого символа с учетом фона под ним
+func (c *ImageCaptcha) assignGlyphColors(s *scene) {
+	if c.glyphColors == nil {
+		return
+	}
+
+	for i := range s.glyphs {
+		g := &s.glyphs[i]
+		area := image.Rect(g.x, g.y-c.charHeight/2, g.x+c.charWidth, g.y+c.charHeight/2)
+		background := averageColor(s.background, area)
+
+		// На прозрачном фоне контраст не определен: цвет берется без проверки
+		if background[3] == 0 {
+			g.color = c.glyphColors.random()
+			continue
+		}
+		g.color = c.glyphColors.pick(background)
+	}
+}
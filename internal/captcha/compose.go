@@ -0,0 +1,45 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// premultiplied переводит цвет в [R, G, B, A] 0..255 с премультиплицированной альфой
+func premultiplied(c color.Color) [4]float64 {
+	r, g, b, a := c.RGBA()
+	return [4]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8), float64(a >> 8)}
+}
+
+// blendColor накладывает цвет на пиксель изображения по правилу "over"
+func blendColor(img *image.RGBA, x, y int, c color.Color) {
+	blendPixel(img, x, y, premultiplied(c))
+}
+
+// blendPixel накладывает цвет на пиксель изображения по правилу Портера-Даффа "over"
+func blendPixel(img *image.RGBA, x, y int, src [4]float64) {
+	if !image.Pt(x, y).In(img.Rect) {
+		return
+	}
+
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+4 : i+4]
+	inv := 1 - src[3]/255
+	for k := 0; k < 4; k++ {
+		p[k] = uint8(math.Min(255, math.Round(src[k]+float64(p[k])*inv)))
+	}
+}
+
+// setPixel записывает цвет в пиксель без смешивания
+func setPixel(img *image.RGBA, x, y int, c [4]float64) {
+	if !image.Pt(x, y).In(img.Rect) {
+		return
+	}
+
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+4 : i+4]
+	for k := 0; k < 4; k++ {
+		p[k] = uint8(math.Max(0, math.Min(255, math.Round(c[k]))))
+	}
+}
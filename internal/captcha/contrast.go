@@ -0,0 +1,41 @@
+package captcha
+
+import (
+	"image/color"
+	"math"
+)
+
+// ContrastRatio возвращает коэффициент контраста двух цветов по WCAG 2.x:
+// от 1 (одинаковые цвета) до 21 (черный на белом)
+func ContrastRatio(a, b color.Color) float64 {
+	return contrastRatio(premultiplied(a), premultiplied(b))
+}
+
+func contrastRatio(a, b [4]float64) float64 {
+	la := relativeLuminance(a)
+	lb := relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// relativeLuminance возвращает относительную яркость цвета по WCAG.
+// Прозрачность не учитывается: цвет берется без премультипликации
+func relativeLuminance(c [4]float64) float64 {
+	if c[3] == 0 {
+		return 0
+	}
+	r := linearize(c[0] / c[3])
+	g := linearize(c[1] / c[3])
+	b := linearize(c[2] / c[3])
+	return 0.2126*r + 0.7152*g + 0.0722*b
+}
+
+// linearize переводит компоненту sRGB (0..1) в линейное пространство
+func linearize(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
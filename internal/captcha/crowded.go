@@ -0,0 +1,100 @@
+package captcha
+
+import (
+	"math"
+	"math/rand"
+	"unicode"
+
+	"golang.org/x/image/font"
+)
+
+// Максимальное вертикальное смещение символа в плотной раскладке (логических пикселей).
+// Меньше, чем в обычной: при больших смещениях соседние символы перестают касаться
+const maxCrowdedVerticalOffset = 3
+
+// Расстояние между словами в плотной раскладке (логических пикселей)
+const crowdedWordSpacing = 12
+
+// crowdedLayout ставит символы вплотную по горизонтальным границам глифов
+// вокруг вертикального центра centerY: каждый следующий символ заходит
+// на предыдущий на overlap пикселей. Такие символы нельзя разделить
+// по пустым столбцам между ними. Пробел разделяет слова промежутком
+func (c *ImageCaptcha) crowdedLayout(chars []rune, overlap int, centerY int) []glyph {
+	if len(chars) == 0 {
+		return nil
+	}
+
+	// Горизонтальные границы глифа во временном изображении символа.
+	// Символ масштабируется относительно центра области, границы вместе с ним
+	originX, _ := c.glyphOrigin()
+	center := float64(c.charWidth) / 2
+	left := make([]int, len(chars))
+	right := make([]int, len(chars))
+	sizes := make([]float64, len(chars))
+	shears := make([]float64, len(chars))
+	for i, ch := range chars {
+		sizes[i], shears[i] = c.randomShape()
+		if unicode.IsSpace(ch) {
+			// Граница пробела учитывает наложение с обеих сторон,
+			// поэтому между словами остается ровно crowdedWordSpacing
+			right[i] = c.px(crowdedWordSpacing) + 2*overlap
+			continue
+		}
+		bounds, _ := font.BoundString(*c.font, string(ch))
+		left[i] = int(math.Floor(center + (float64(originX+bounds.Min.X.Floor())-center)*sizes[i]))
+		right[i] = int(math.Ceil(center + (float64(originX+bounds.Max.X.Ceil())-center)*sizes[i]))
+	}
+
+	// Смещения областей символов относительно первой
+	offsets := make([]int, len(chars))
+	for i := 1; i < len(chars); i++ {
+		offsets[i] = offsets[i-1] + right[i-1] - left[i] - overlap
+	}
+
+	// Центрируем текст по горизонтали, не заходя за отступ у левого края
+	last := len(chars) - 1
+	textWidth := offsets[last] + right[last] - left[0]
+	startX := (c.imageWidth-textWidth)/2 - left[0]
+	if margin := c.px(10); startX+left[0] < margin {
+		startX = margin - left[0]
+	}
+
+	maxRotation := c.maxRotation * math.Pi / 180
+	maxVerticalOffset := c.px(maxCrowdedVerticalOffset)
+
+	glyphs := make([]glyph, 0, len(chars))
+	for i, ch := range chars {
+		if unicode.IsSpace(ch) {
+			continue
+		}
+		glyphs = append(glyphs, glyph{
+			char:  ch,
+			x:     startX + offsets[i],
+			y:     centerY + rand.Intn(2*maxVerticalOffset+1) - maxVerticalOffset,
+			angle: (rand.Float64()*2 - 1) * maxRotation,
+			size:  sizes[i],
+			shear: shears[i],
+		})
+	}
+
+	return glyphs
+}
+
+// crowdedThresholds возвращает пороги проверки для плотной раскладки.
+// Перекрытие символов здесь намеренное и не проверяется, а видимость
+// и обрезка каждого символа проверяются всегда
+func crowdedThresholds(guard *QualityThresholds) QualityThresholds {
+	if guard == nil {
+		return QualityThresholds{
+			MaxClippedRatio: DefaultQualityThresholds.MaxClippedRatio,
+			MinVisible:      DefaultQualityThresholds.MinVisible,
+		}
+	}
+
+	t := *guard
+	t.MaxOverlap = 0
+	if t.MinVisible == 0 {
+		t.MinVisible = DefaultQualityThresholds.MinVisible
+	}
+	return t
+}
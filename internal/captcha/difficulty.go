@@ -0,0 +1,95 @@
+package captcha
+
+import "fmt"
+
+// Difficulty задает уровень сложности капчи
+type Difficulty int
+
+const (
+	DifficultyEasy Difficulty = iota
+	DifficultyNormal
+	DifficultyHard
+	DifficultyExtreme
+)
+
+func (d Difficulty) String() string {
+	switch d {
+	case DifficultyEasy:
+		return "easy"
+	case DifficultyNormal:
+		return "normal"
+	case DifficultyHard:
+		return "hard"
+	case DifficultyExtreme:
+		return "extreme"
+	default:
+		return fmt.Sprintf("difficulty(%d)", int(d))
+	}
+}
+
+// DifficultyPreset описывает параметры генерации для уровня сложности
+type DifficultyPreset struct {
+	CodeLength      int     // Рекомендуемая длина кода
+	NoiseDots       int     // Количество точек-помех
+	NoiseLines      int     // Количество линий-помех
+	DistortionScale float64 // Множитель амплитуды искажения
+	MaxRotation     float64 // Максимальный угол поворота символа в градусах
+}
+
+var difficultyPresets = map[Difficulty]DifficultyPreset{
+	DifficultyEasy: {
+		CodeLength:      4,
+		NoiseDots:       60,
+		NoiseLines:      3,
+		DistortionScale: 0.6,
+		MaxRotation:     12,
+	},
+	DifficultyNormal: {
+		CodeLength:      6,
+		NoiseDots:       defaultNoiseDots,
+		NoiseLines:      defaultNoiseLines,
+		DistortionScale: defaultDistortionScale,
+		MaxRotation:     defaultMaxRotation,
+	},
+	DifficultyHard: {
+		CodeLength:      7,
+		NoiseDots:       180,
+		NoiseLines:      8,
+		DistortionScale: 1.4,
+		MaxRotation:     25,
+	},
+	DifficultyExtreme: {
+		CodeLength:      8,
+		NoiseDots:       260,
+		NoiseLines:      12,
+		DistortionScale: 1.8,
+		MaxRotation:     30,
+	},
+}
+
+// Preset возвращает параметры уровня сложности.
+// Значения вне диапазона приводятся к ближайшему существующему уровню
+func (d Difficulty) Preset() DifficultyPreset {
+	if d < DifficultyEasy {
+		d = DifficultyEasy
+	} else if d > DifficultyExtreme {
+		d = DifficultyExtreme
+	}
+	return difficultyPresets[d]
+}
+
+// Code генерирует случайный код длины CodeLength из пресета уровня
+func (d Difficulty) Code() string {
+	return RandomCode(d.Preset().CodeLength)
+}
+
+// Apply возвращает копию конфигурации с параметрами сложности из пресета.
+// Длина кода не входит в конфигурацию: код нужной длины возвращает Code
+func (d Difficulty) Apply(config ImageCaptchaConfig) ImageCaptchaConfig {
+	preset := d.Preset()
+	config.NoiseDots = preset.NoiseDots
+	config.NoiseLines = preset.NoiseLines
+	config.DistortionScale = preset.DistortionScale
+	config.MaxRotation = preset.MaxRotation
+	return config
+}
@@ -0,0 +1,75 @@
+package captcha
+
+import (
+	"strings"
+	"time"
+)
+
+// EvalResult — результат распознавания набора капч одного уровня сложности
+type EvalResult struct {
+	Difficulty    Difficulty
+	Samples       int // Количество капч в наборе
+	Solved        int // Количество полностью распознанных капч
+	CorrectChars  int // Количество верно распознанных символов на своих позициях
+	TotalChars    int // Общее количество символов в наборе
+	SolverErrors  int // Количество капч, на которых распознаватель вернул ошибку
+	TotalDuration time.Duration
+}
+
+// SolveRate возвращает долю полностью распознанных капч
+func (r EvalResult) SolveRate() float64 {
+	if r.Samples == 0 {
+		return 0
+	}
+	return float64(r.Solved) / float64(r.Samples)
+}
+
+// CharAccuracy возвращает долю верно распознанных символов
+func (r EvalResult) CharAccuracy() float64 {
+	if r.TotalChars == 0 {
+		return 0
+	}
+	return float64(r.CorrectChars) / float64(r.TotalChars)
+}
+
+// Evaluate генерирует для каждого уровня сложности набор капч
+// со случайными кодами и прогоняет их через распознаватель
+func Evaluate(config ImageCaptchaConfig, solver Solver, samples int, difficulties ...Difficulty) []EvalResult {
+	if len(difficulties) == 0 {
+		difficulties = []Difficulty{DifficultyEasy, DifficultyNormal, DifficultyHard, DifficultyExtreme}
+	}
+
+	results := make([]EvalResult, 0, len(difficulties))
+	for _, d := range difficulties {
+		generator := NewImageCaptcha(d.Apply(config))
+		result := EvalResult{Difficulty: d, Samples: samples}
+
+		for i := 0; i < samples; i++ {
+			code := d.Code()
+			img := generator.Render(code).Image
+
+			start := time.Now()
+			answer, err := solver.Solve(img)
+			result.TotalDuration += time.Since(start)
+
+			result.TotalChars += len(code)
+			if err != nil {
+				result.SolverErrors++
+				continue
+			}
+
+			if strings.EqualFold(answer, code) {
+				result.Solved++
+			}
+			for j, ch := range []rune(strings.ToUpper(answer)) {
+				if j < len(code) && rune(code[j]) == ch {
+					result.CorrectChars++
+				}
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,267 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// GlyphStyle задает способ отрисовки символов
+type GlyphStyle int
+
+const (
+	// Сплошная заливка цветом символа (по умолчанию)
+	GlyphFill GlyphStyle = iota
+	// Только контур символа, внутри символ пустой
+	GlyphOutline
+	// Заливка цветом символа с контуром цвета OutlineColor
+	GlyphOutlineFill
+	// Заливка с тенью, смещенной вправо и вниз
+	GlyphShadow
+	// Заливка текстурой GlyphTexture
+	GlyphTextured
+)
+
+const (
+	defaultOutlineWidth = 1.5 // логических пикселей
+	defaultShadowOffset = 2.0 // логических пикселей
+
+	// Количество отрезков, на которые разбиваются кривые контура глифа
+	glyphCurveSegments = 10
+)
+
+var (
+	defaultOutlineColor color.Color = color.Black
+	defaultShadowColor  color.Color = color.NRGBA{A: 110}
+)
+
+// glyphImage рисует символ выбранным стилем во временном изображении
+// (см. glyphCell) и возвращает масштаб, с которым изображение переносится
+// на капчу. Если у символа есть контур, масштабированный символ сразу
+// растеризуется в нужном размере и переносится без масштабирования:
+// увеличенный растр выглядел бы размытым
+func (c *ImageCaptcha) glyphImage(g glyph) (*image.RGBA, float64) {
+	contours, size := c.glyphShape(g)
+	charImg := image.NewRGBA(c.glyphCell(g.char, contours))
+
+	// Без контура (нет OutlineFont или символа в нем) рисуем обычной заливкой
+	if contours == nil {
+		c.fillGlyph(charImg, g)
+		return charImg, size
+	}
+
+	switch c.glyphStyle {
+	case GlyphFill:
+		fillMask(charImg, contourRasterizer(charImg, contours, point{}), c.glyphColor(g))
+	case GlyphOutline:
+		strokeContours(charImg, contours, c.outlineWidth, c.glyphColor(g))
+	case GlyphOutlineFill:
+		fillMask(charImg, contourRasterizer(charImg, contours, point{}), c.glyphColor(g))
+		strokeContours(charImg, contours, c.outlineWidth, c.outlineColor)
+	case GlyphShadow:
+		fillMask(charImg, contourRasterizer(charImg, contours, c.shadowShift(g)), c.shadowColor)
+		fillMask(charImg, contourRasterizer(charImg, contours, point{}), c.glyphColor(g))
+	case GlyphTextured:
+		if c.glyphTexture == nil {
+			fillMask(charImg, contourRasterizer(charImg, contours, point{}), c.glyphColor(g))
+			break
+		}
+		texture := image.NewRGBA(charImg.Rect)
+		c.glyphTexture.Draw(texture, c.scale)
+		fillPattern(charImg, contourRasterizer(charImg, contours, point{}), func(x, y int) [4]float64 {
+			return pixelAt(texture, x, y)
+		})
+	}
+
+	return charImg, size
+}
+
+// glyphShape возвращает контуры, по которым glyphImage рисует символ
+// (nil — заливка через font.Drawer), и масштаб переноса символа на капчу
+func (c *ImageCaptcha) glyphShape(g glyph) ([][]point, float64) {
+	size := g.sizeOrDefault()
+	contours := c.styledContours(g.char)
+	if size != 1 {
+		if contours == nil {
+			contours = c.glyphContours(g.char)
+		}
+		if contours != nil {
+			return c.scaleContours(contours, size), 1
+		}
+	}
+	return contours, size
+}
+
+// styledContours возвращает контуры символа, если выбранный стиль рисует
+// символ по контуру, и nil для сплошной заливки через font.Drawer
+func (c *ImageCaptcha) styledContours(ch rune) [][]point {
+	if c.glyphStyle == GlyphFill {
+		return nil
+	}
+	return c.glyphContours(ch)
+}
+
+// glyphCell возвращает область временного изображения символа: ячейку
+// charWidth x charHeight, расширенную так, чтобы в нее целиком поместился
+// символ вместе с обводкой и тенью. Крупный шрифт выходит за базовую ячейку,
+// и без расширения символ обрезался бы по ее краю. Координаты совпадают
+// с координатами базовой ячейки, поэтому левый верхний угол может быть
+// отрицательным
+func (c *ImageCaptcha) glyphCell(ch rune, contours [][]point) image.Rectangle {
+	cell := image.Rect(0, 0, c.charWidth, c.charHeight)
+
+	var ink image.Rectangle
+	if contours != nil {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		for _, contour := range contours {
+			for _, p := range contour {
+				minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+				minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+			}
+		}
+		ink = image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+	} else {
+		bounds, _ := font.BoundString(*c.font, string(ch))
+		originX, originY := c.glyphOrigin()
+		ink = image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil()).
+			Add(image.Pt(originX, originY))
+	}
+	if ink.Empty() {
+		return cell
+	}
+
+	// Запас на обводку, тень и сглаживание краев
+	margin := int(math.Ceil(c.outlineWidth+math.Sqrt2*math.Abs(c.shadowOffset))) + 2
+	return cell.Union(ink.Inset(-margin))
+}
+
+// fillGlyph рисует символ сплошной заливкой через font.Drawer
+func (c *ImageCaptcha) fillGlyph(charImg *image.RGBA, g glyph) {
+	originX, originY := c.glyphOrigin()
+	charDrawer := &font.Drawer{
+		Dst:  charImg,
+		Src:  image.NewUniform(c.glyphColor(g)),
+		Face: *c.font,
+		Dot:  fixed.P(originX, originY),
+	}
+	charDrawer.DrawString(string(g.char))
+}
+
+// shadowShift возвращает смещение тени во временном изображении символа.
+// Символ потом поворачивается, поэтому смещение поворачиваем в обратную
+// сторону: у всех символов тень падает в одном направлении
+func (c *ImageCaptcha) shadowShift(g glyph) point {
+	sin, cos := math.Sincos(g.angle)
+	d := c.shadowOffset
+	return point{x: d*cos + d*sin, y: -d*sin + d*cos}
+}
+
+// glyphContours возвращает контуры глифа из OutlineFont в координатах
+// временного изображения символа. Кривые разбиваются на отрезки,
+// каждый контур замкнут. Возвращает nil, если контура нет
+func (c *ImageCaptcha) glyphContours(ch rune) [][]point {
+	if c.outlineFont == nil {
+		return nil
+	}
+
+	var buf sfnt.Buffer
+	index, err := c.outlineFont.GlyphIndex(&buf, ch)
+	if err != nil || index == 0 {
+		return nil
+	}
+	segments, err := c.outlineFont.LoadGlyph(&buf, index, fixed.I(c.fontSize), nil)
+	if err != nil {
+		return nil
+	}
+
+	// Начало строки такое же, как у font.Drawer в fillGlyph
+	originX, originY := c.glyphOrigin()
+	at := func(p fixed.Point26_6) point {
+		return point{x: float64(originX) + float64(p.X)/64, y: float64(originY) + float64(p.Y)/64}
+	}
+
+	contours := [][]point{}
+	var contour []point
+	closeContour := func() {
+		if len(contour) > 1 {
+			contours = append(contours, append(contour, contour[0]))
+		}
+		contour = nil
+	}
+
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			closeContour()
+			contour = []point{at(seg.Args[0])}
+		case sfnt.SegmentOpLineTo:
+			contour = append(contour, at(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			// Квадратичную кривую записываем как кубическую с теми же концами
+			p0, p1, p2 := contour[len(contour)-1], at(seg.Args[0]), at(seg.Args[1])
+			c1 := point{p0.x + 2*(p1.x-p0.x)/3, p0.y + 2*(p1.y-p0.y)/3}
+			c2 := point{p2.x + 2*(p1.x-p2.x)/3, p2.y + 2*(p1.y-p2.y)/3}
+			contour = append(contour, cubicBezier(p0, c1, c2, p2, glyphCurveSegments)[1:]...)
+		case sfnt.SegmentOpCubeTo:
+			p0 := contour[len(contour)-1]
+			curve := cubicBezier(p0, at(seg.Args[0]), at(seg.Args[1]), at(seg.Args[2]), glyphCurveSegments)
+			contour = append(contour, curve[1:]...)
+		}
+	}
+	closeContour()
+
+	if len(contours) == 0 {
+		return nil
+	}
+	return contours
+}
+
+// scaleContours масштабирует контуры глифа относительно центра ячейки
+// символа, как drawGlyph масштабирует растровый символ
+func (c *ImageCaptcha) scaleContours(contours [][]point, size float64) [][]point {
+	centerX := float64(c.charWidth / 2)
+	centerY := float64(c.charHeight / 2)
+	scaled := make([][]point, len(contours))
+	for i, contour := range contours {
+		scaled[i] = make([]point, len(contour))
+		for j, p := range contour {
+			scaled[i][j] = point{x: centerX + (p.x-centerX)*size, y: centerY + (p.y-centerY)*size}
+		}
+	}
+	return scaled
+}
+
+// contourRasterizer добавляет контуры глифа, сдвинутые на shift, в растеризатор
+// размером с изображение. Внешние и внутренние контуры глифа обходятся
+// в разные стороны, поэтому отверстия (как в "O") остаются пустыми
+func contourRasterizer(img *image.RGBA, contours [][]point, shift point) *vector.Rasterizer {
+	r := vector.NewRasterizer(img.Rect.Dx(), img.Rect.Dy())
+	// Растеризатор отсчитывает координаты от левого верхнего угла изображения
+	shift.x -= float64(img.Rect.Min.X)
+	shift.y -= float64(img.Rect.Min.Y)
+	for _, contour := range contours {
+		r.MoveTo(float32(contour[0].x+shift.x), float32(contour[0].y+shift.y))
+		for _, p := range contour[1:] {
+			r.LineTo(float32(p.x+shift.x), float32(p.y+shift.y))
+		}
+		r.ClosePath()
+	}
+	return r
+}
+
+// strokeContours обводит контуры глифа линией заданной толщины
+func strokeContours(img *image.RGBA, contours [][]point, width float64, c color.Color) {
+	for _, contour := range contours {
+		widths := make([]float64, len(contour))
+		for i := range widths {
+			widths[i] = width
+		}
+		strokePolyline(img, contour, widths, c)
+	}
+}
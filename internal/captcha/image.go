@@ -2,15 +2,17 @@ package captcha
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/color"
 	"image/png"
 	"math"
 	"math/rand"
 	"time"
+	"unicode"
 
 	"golang.org/x/image/font"
-	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/font/opentype"
 )
 
 type ImageCaptchaConfig struct {
@@ -20,62 +22,481 @@ type ImageCaptchaConfig struct {
 	FontSize        int
 	ImageWidth      int
 	ImageHeight     int
+
+	// Параметры сложности. Нулевые значения заменяются значениями по умолчанию
+	NoiseDots       int     // Количество точек-помех (по умолчанию 100)
+	NoiseLines      int     // Количество линий-помех (по умолчанию 5)
+	NoiseArcs       int     // Количество дуг-помех (по умолчанию отключены)
+	NoiseLineWidth  float64 // Наибольшая толщина линий и дуг в логических пикселях (по умолчанию 2)
+	DistortionScale float64 // Множитель амплитуды волнового искажения (по умолчанию 1.0)
+	MaxRotation     float64 // Максимальный угол поворота символа в градусах (по умолчанию 20)
+
+	// Случайные искажения отдельных символов: масштаб и наклон выбираются
+	// для каждого символа, прогиб базовой линии — для всей капчи.
+	// Раскладка оставляет место под наибольшие значения, если оно есть в изображении.
+	// С OutlineFont масштабированные символы растеризуются сразу в нужном размере
+	CharScaleMin     float64 // Наименьший масштаб символа (по умолчанию 1)
+	CharScaleMax     float64 // Наибольший масштаб символа (по умолчанию 1)
+	ShearMin         float64 // Наименьший наклон символа как тангенс угла (0.2 ≈ 11°)
+	ShearMax         float64 // Наибольший наклон символа
+	BaselineCurveMin float64 // Наименьший прогиб базовой линии в логических пикселях
+	BaselineCurveMax float64 // Наибольший прогиб; положительный прогибает середину вниз
+
+	// Диапазоны параметров волнового искажения. Амплитуда, частота и фаза
+	// каждой волны выбираются случайно для каждой капчи
+	WaveAmplitudeMin float64 // Логических пикселей (по умолчанию 1.5)
+	WaveAmplitudeMax float64 // Логических пикселей (по умолчанию 3.5)
+	WaveFrequencyMin float64 // Радиан на логический пиксель (по умолчанию 0.06)
+	WaveFrequencyMax float64 // Радиан на логический пиксель (по умолчанию 0.16)
+
+	// Дополнительные стадии искажения, применяются по порядку перед волновым.
+	// Параметры стадий выбираются случайно для каждой капчи
+	Distortions []Distortion
+
+	// Плотная раскладка: символы ставятся вплотную по контурам глифов
+	// и заходят друг на друга на CharOverlap логических пикселей (0 — касаются).
+	// Каждая капча проверяется анализатором: перекрытие не ограничивается,
+	// но каждый символ должен остаться видимым (см. QualityThresholds.MinVisible)
+	Crowded     bool
+	CharOverlap float64
+
+	// Количество строк текста. Код делится на строки по переводам строки "\n",
+	// иначе — по пробелу, ближайшему к середине строки, или поровну.
+	// По умолчанию изображения выше своей ширины получают две строки, остальные — одну
+	Lines int
+
+	// Расположение символов: строка, столбец, дуга или круг (по умолчанию строка).
+	// Lines и Crowded действуют только для LayoutLine
+	Layout Layout
+
+	// Палитры точек и линий-помех. Если не заданы, цвета выбираются случайно
+	NoisePalette []color.Color
+	LinePalette  []color.Color
+
+	// Кривые Безье, пересекающие полосу текста. В отличие от линий-помех
+	// каждая кривая проходит через несколько символов и мешает их разделению
+	BandCurves          int     // Количество кривых (по умолчанию отключены)
+	BandCurveWidth      float64 // Наибольшая толщина кривой в логических пикселях (по умолчанию 2)
+	BandCurvesTextColor bool    // Рисовать кривые цветом символов, а не из LinePalette
+
+	// Анимированный режим: при AnimationFrames > 1 Generate возвращает GIF,
+	// в котором помехи движутся, а символы дрожат между кадрами
+	AnimationFrames int           // Количество кадров анимации
+	AnimationDelay  time.Duration // Задержка между кадрами (по умолчанию 100 мс)
+
+	// Шрифт с контурами глифов. Нужен для векторного вывода (SVGCaptcha)
+	// и для пересоздания Font с учетом Scale
+	OutlineFont *opentype.Font
+
+	// Прозрачный фон: BackgroundColor игнорируется, фон и края искажения
+	// остаются прозрачными, PNG и GIF сохраняют прозрачность
+	TransparentBackground bool
+
+	// Генератор фона (градиент, текстура, сетка, фрагмент изображения).
+	// Если не задан, фон заливается BackgroundColor
+	Background Background
+
+	// Стиль символов: контур, контур с заливкой, тень или текстура.
+	// Стили, кроме GlyphFill, растеризуют контур глифа из OutlineFont;
+	// без OutlineFont символы рисуются сплошной заливкой
+	GlyphStyle   GlyphStyle
+	OutlineWidth float64     // Толщина контура в логических пикселях (по умолчанию 1.5)
+	OutlineColor color.Color // Цвет контура для GlyphOutlineFill (по умолчанию черный)
+	ShadowColor  color.Color // Цвет тени для GlyphShadow (по умолчанию полупрозрачный черный)
+	ShadowOffset float64     // Смещение тени в логических пикселях (по умолчанию 2)
+	GlyphTexture Background  // Текстура для GlyphTextured; без нее символы заливаются цветом
+
+	// Случайные цвета символов с гарантией контраста.
+	// Если не заданы, все символы рисуются цветом TextColor
+	GlyphColors *GlyphColors
+
+	// Проверка качества отрисовки: если задана, Generate перегенерирует
+	// капчу, пока она не пройдет проверку (см. Analyze)
+	QualityGuard *QualityThresholds
+
+	// Метод интерполяции при повороте символов (по умолчанию билинейная)
+	Interpolation Interpolation
+
+	// Масштаб для экранов высокой плотности (по умолчанию 1).
+	// ImageWidth, ImageHeight и FontSize задаются в логических пикселях,
+	// итоговое изображение имеет размер ImageWidth*Scale x ImageHeight*Scale.
+	// Если OutlineFont не задан, Font должен быть создан с DPI 72*Scale
+	Scale float64
 }
 
+const (
+	defaultNoiseDots        = 100
+	defaultNoiseLines       = 5
+	defaultDistortionScale  = 1.0
+	defaultMaxRotation      = 20.0
+	defaultWaveAmplitudeMin = 1.5
+	defaultWaveAmplitudeMax = 3.5
+	defaultWaveFrequencyMin = 0.06
+	defaultWaveFrequencyMax = 0.16
+	defaultNoiseLineWidth   = 2.0
+	defaultBandCurveWidth   = 2.0
+	defaultScale            = 1.0
+)
+
 type ImageCaptcha struct {
-	backgroundColor color.Color
-	textColor       color.Color
-	font            *font.Face
-	fontSize        int
-	imageWidth      int
-	imageHeight     int
+	backgroundColor  color.Color
+	textColor        color.Color
+	font             *font.Face
+	fontSize         int
+	imageWidth       int
+	imageHeight      int
+	noiseDots        int
+	noiseLines       int
+	noiseArcs        int
+	noiseLineWidth   float64
+	distortionScale  float64
+	maxRotation      float64
+	charScaleMin     float64
+	charScaleMax     float64
+	shearMin         float64
+	shearMax         float64
+	curveMin         float64
+	curveMax         float64
+	distortions      []Distortion
+	crowded          bool
+	charOverlap      int
+	lines            int
+	textLayout       Layout
+	waveAmplitudeMin float64
+	waveAmplitudeMax float64
+	waveFrequencyMin float64
+	waveFrequencyMax float64
+	noisePalette     []color.Color
+	linePalette      []color.Color
+	bandCurves       int
+	bandCurveWidth   float64
+	bandTextColor    bool
+	animationFrames  int
+	animationDelay   time.Duration
+	outlineFont      *opentype.Font
+	scale            float64
+	interpolation    Interpolation
+	transparent      bool
+	background       Background
+	qualityGuard     *QualityThresholds
+	glyphColors      *GlyphColors
+	glyphStyle       GlyphStyle
+	outlineWidth     float64
+	outlineColor     color.Color
+	shadowColor      color.Color
+	shadowOffset     float64
+	glyphTexture     Background
+	charWidth        int
+	charHeight       int
 }
 
 func NewImageCaptcha(config ImageCaptchaConfig) *ImageCaptcha {
-	return &ImageCaptcha{
-		backgroundColor: config.BackgroundColor,
-		textColor:       config.TextColor,
-		font:            config.Font,
-		fontSize:        config.FontSize,
-		imageWidth:      config.ImageWidth,
-		imageHeight:     config.ImageHeight,
+	c := &ImageCaptcha{
+		backgroundColor:  config.BackgroundColor,
+		textColor:        config.TextColor,
+		font:             config.Font,
+		fontSize:         config.FontSize,
+		imageWidth:       config.ImageWidth,
+		imageHeight:      config.ImageHeight,
+		noiseDots:        config.NoiseDots,
+		noiseLines:       config.NoiseLines,
+		noiseArcs:        config.NoiseArcs,
+		noiseLineWidth:   config.NoiseLineWidth,
+		distortionScale:  config.DistortionScale,
+		maxRotation:      config.MaxRotation,
+		charScaleMin:     config.CharScaleMin,
+		charScaleMax:     config.CharScaleMax,
+		shearMin:         config.ShearMin,
+		shearMax:         config.ShearMax,
+		curveMin:         config.BaselineCurveMin,
+		curveMax:         config.BaselineCurveMax,
+		distortions:      config.Distortions,
+		crowded:          config.Crowded,
+		lines:            config.Lines,
+		textLayout:       config.Layout,
+		waveAmplitudeMin: config.WaveAmplitudeMin,
+		waveAmplitudeMax: config.WaveAmplitudeMax,
+		waveFrequencyMin: config.WaveFrequencyMin,
+		waveFrequencyMax: config.WaveFrequencyMax,
+		noisePalette:     config.NoisePalette,
+		linePalette:      config.LinePalette,
+		bandCurves:       config.BandCurves,
+		bandCurveWidth:   config.BandCurveWidth,
+		bandTextColor:    config.BandCurvesTextColor,
+		animationFrames:  config.AnimationFrames,
+		animationDelay:   config.AnimationDelay,
+		outlineFont:      config.OutlineFont,
+		scale:            config.Scale,
+		interpolation:    config.Interpolation,
+		transparent:      config.TransparentBackground,
+		background:       config.Background,
+		qualityGuard:     config.QualityGuard,
+		glyphColors:      config.GlyphColors,
+		glyphStyle:       config.GlyphStyle,
+		outlineWidth:     config.OutlineWidth,
+		shadowOffset:     config.ShadowOffset,
+		outlineColor:     config.OutlineColor,
+		shadowColor:      config.ShadowColor,
+		glyphTexture:     config.GlyphTexture,
+	}
+
+	// Подставляем значения по умолчанию для незаданных параметров сложности
+	if c.noiseDots == 0 {
+		c.noiseDots = defaultNoiseDots
+	}
+	if c.noiseLines == 0 {
+		c.noiseLines = defaultNoiseLines
+	}
+	if c.distortionScale == 0 {
+		c.distortionScale = defaultDistortionScale
+	}
+	if c.maxRotation == 0 {
+		c.maxRotation = defaultMaxRotation
+	}
+	if c.charScaleMin <= 0 {
+		c.charScaleMin = 1
+	}
+	c.charScaleMax = math.Max(c.charScaleMax, c.charScaleMin)
+	c.shearMax = math.Max(c.shearMax, c.shearMin)
+	c.curveMax = math.Max(c.curveMax, c.curveMin)
+	if c.waveAmplitudeMin == 0 && c.waveAmplitudeMax == 0 {
+		c.waveAmplitudeMin, c.waveAmplitudeMax = defaultWaveAmplitudeMin, defaultWaveAmplitudeMax
+	}
+	if c.waveFrequencyMin == 0 && c.waveFrequencyMax == 0 {
+		c.waveFrequencyMin, c.waveFrequencyMax = defaultWaveFrequencyMin, defaultWaveFrequencyMax
 	}
+	// Если задана только нижняя граница, диапазон вырождается в точку
+	c.waveAmplitudeMax = math.Max(c.waveAmplitudeMax, c.waveAmplitudeMin)
+	c.waveFrequencyMax = math.Max(c.waveFrequencyMax, c.waveFrequencyMin)
+	if c.noiseLineWidth <= 0 {
+		c.noiseLineWidth = defaultNoiseLineWidth
+	}
+	if c.bandCurveWidth <= 0 {
+		c.bandCurveWidth = defaultBandCurveWidth
+	}
+	if c.outlineWidth <= 0 {
+		c.outlineWidth = defaultOutlineWidth
+	}
+	if c.outlineColor == nil {
+		c.outlineColor = defaultOutlineColor
+	}
+	if c.shadowColor == nil {
+		c.shadowColor = defaultShadowColor
+	}
+	if c.shadowOffset == 0 {
+		c.shadowOffset = defaultShadowOffset
+	}
+	if c.animationDelay == 0 {
+		c.animationDelay = defaultAnimationDelay
+	}
+	if c.scale <= 0 {
+		c.scale = defaultScale
+	}
+	if c.transparent {
+		c.backgroundColor = color.Transparent
+	}
+
+	// Переводим логические размеры в физические пиксели
+	c.imageWidth = c.px(float64(config.ImageWidth))
+	c.imageHeight = c.px(float64(config.ImageHeight))
+	c.fontSize = c.px(float64(config.FontSize))
+	c.charWidth = c.px(baseCharWidth)
+	c.charHeight = c.px(baseCharHeight)
+	c.charOverlap = c.px(config.CharOverlap)
+	c.outlineWidth *= c.scale
+	c.shadowOffset *= c.scale
+
+	// Пересоздаем шрифт с плотностью, соответствующей масштабу
+	if c.scale != 1 && c.outlineFont != nil {
+		face, err := opentype.NewFace(c.outlineFont, &opentype.FaceOptions{
+			Size:    float64(config.FontSize),
+			DPI:     72 * c.scale,
+			Hinting: font.HintingFull,
+		})
+		if err == nil {
+			c.font = &face
+		}
+	}
+
+	return c
 }
 
 func (c *ImageCaptcha) Generate(code string) ([]byte, error) {
-	// Создаем изображение с заданными размерами
-	width := c.imageWidth
-	height := c.imageHeight
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rand.Seed(time.Now().UnixNano())
 
-	// Заполняем фон
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			img.Set(x, y, c.backgroundColor)
+	s, err := c.newCheckedScene(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.animationFrames > 1 {
+		return c.generateAnimated(s)
+	}
+
+	finalImage := s.frame
+	if finalImage == nil {
+		finalImage = c.render(s, 0)
+	}
+
+	// Кодируем изображение в PNG
+	var buf bytes.Buffer
+	err = png.Encode(&buf, finalImage)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Количество попыток получить сцену, прошедшую проверку качества
+const maxQualityAttempts = 5
+
+// newCheckedScene генерирует сцену и, если задана проверка качества
+// или включена плотная раскладка, повторяет генерацию, пока отрисовка
+// не пройдет проверку
+func (c *ImageCaptcha) newCheckedScene(code string) (*scene, error) {
+	guard := c.qualityGuard
+	if c.crowded {
+		thresholds := crowdedThresholds(c.qualityGuard)
+		guard = &thresholds
+	}
+	if guard == nil {
+		return c.newScene(code), nil
+	}
+
+	var err error
+	for attempt := 0; attempt < maxQualityAttempts; attempt++ {
+		// В плотной раскладке с каждой попыткой уменьшаем наложение:
+		// на последней символы только касаются друг друга
+		overlap := c.charOverlap * (maxQualityAttempts - 1 - attempt) / (maxQualityAttempts - 1)
+		s := c.newSceneWithOverlap(code, overlap)
+		s.frame, s.layouts = c.render(s, 0), c.glyphLayouts(s)
+		if err = Analyze(s.frame, s.layouts).Check(*guard); err == nil {
+			return s, nil
 		}
 	}
 
-	// Рисуем текст капчи с поворотом и смещением символов
-	rand.Seed(time.Now().UnixNano())
+	return nil, fmt.Errorf("captcha: render quality check failed after %d attempts: %w", maxQualityAttempts, err)
+}
+
+// Наименьший интервал между символами строки в логических пикселях,
+// до которого сжимается не помещающаяся в изображение строка
+const minCharSpacing = 10
+
+// Размеры временного изображения для одного символа в логических пикселях
+const (
+	baseCharWidth  = 35
+	baseCharHeight = 45
+)
+
+// px переводит логический размер в физические пиксели с учетом масштаба
+func (c *ImageCaptcha) px(v float64) int {
+	return int(math.Round(v * c.scale))
+}
+
+// glyphOrigin возвращает начало строки символа во временном изображении
+func (c *ImageCaptcha) glyphOrigin() (int, int) {
+	return c.px(8), c.charHeight/2 + c.fontSize/2
+}
+
+// glyph описывает положение символа на изображении
+type glyph struct {
+	char  rune
+	x     int     // Левая граница области символа
+	y     int     // Вертикальный центр символа
+	angle float64 // Угол поворота в радианах
+	size  float64 // Масштаб символа относительно центра области (0 — без масштабирования)
+	shear float64 // Наклон символа (тангенс угла, положительный — вправо)
+	color color.Color
+}
+
+// sizeOrDefault возвращает масштаб символа, считая нулевой масштаб единичным
+func (g glyph) sizeOrDefault() float64 {
+	if g.size == 0 {
+		return 1
+	}
+	return g.size
+}
+
+// glyphColor возвращает цвет символа
+func (c *ImageCaptcha) glyphColor(g glyph) color.Color {
+	if g.color != nil {
+		return g.color
+	}
+	return c.textColor
+}
+
+// layout рассчитывает положение, поворот, смещение и форму каждого символа.
+// Строки текста располагаются друг под другом и центрируются по вертикали.
+// overlap используется плотной раскладкой
+func (c *ImageCaptcha) layout(chars []rune, overlap int) []glyph {
+	if c.textLayout != LayoutLine {
+		return c.shapedLayout(chars)
+	}
+
+	lines := c.textLines(chars)
+
+	// Несколько строк центрируются блоком. Одна строка обычной раскладки
+	// отодвигается от краев с учетом поворота символов
+	step := c.lineStep()
+	centerY := c.imageHeight / 2
+	switch {
+	case len(lines) > 1:
+		centerY -= (len(lines) - 1) * step / 2
+	case !c.crowded:
+		centerY = c.lineCenter()
+	}
+
+	var glyphs []glyph
+	for i, line := range lines {
+		var lineGlyphs []glyph
+		if c.crowded {
+			lineGlyphs = c.crowdedLayout(line, overlap, centerY+i*step)
+		} else {
+			lineGlyphs = c.lineLayout(line, centerY+i*step)
+		}
+		c.bendBaseline(lineGlyphs)
+		glyphs = append(glyphs, lineGlyphs...)
+	}
+	return glyphs
+}
+
+// lineLayout располагает символы в строку со случайными интервалами
+// вокруг вертикального центра centerY. Пробел оставляет пустое место
+// шириной в символ и не попадает в раскладку
+func (c *ImageCaptcha) lineLayout(chars []rune, centerY int) []glyph {
+	width := c.imageWidth
+	charWidth := c.charWidth
+
+	// Масштаб и наклон каждого символа выбираем заранее: от них зависят интервалы
+	sizes := make([]float64, len(chars))
+	shears := make([]float64, len(chars))
+	for i := range chars {
+		sizes[i], shears[i] = c.randomShape()
+	}
+
+	// Наибольший размер области символа с учетом масштабирования
+	maxScale := c.charScaleMax
+	scaledWidth, _, maxRotationOffset := c.glyphExtent()
 
-	// Рассчитываем параметры для правильного позиционирования
-	charWidth := 35
-	charHeight := 45
-	maxRotation := 20.0 // Максимальный угол поворота в градусах
+	// Минимальный отступ текста от края изображения
+	margin := c.px(10)
 
-	// Максимальное смещение из-за поворота (диагональ символа * sin(угла))
-	maxRotationRad := maxRotation * math.Pi / 180
-	diagonal := math.Sqrt(float64(charWidth*charWidth + charHeight*charHeight))
-	maxRotationOffset := int(diagonal * math.Sin(maxRotationRad))
+	// Максимальный угол поворота в градусах
+	maxRotation := c.maxRotation
 
 	// Рассчитываем общую ширину текста с учетом поворотов и случайных интервалов
-	// Базовый интервал между символами
-	baseCharSpacing := 25
+	// Базовый интервал между символами: у крупного шрифта не меньше
+	// трех четвертей его размера, иначе широкие символы заходят друг на друга
+	baseCharSpacing := max(c.px(25), c.fontSize*3/4)
+	normalSpacing := baseCharSpacing
 	// Максимальная дополнительная вариация интервала
-	maxSpacingVariation := 5
+	maxSpacingVariation := c.px(5)
 
-	// Рассчитываем максимальную возможную ширину
-	maxTotalWidth := len(code)*charWidth + (len(code)-1)*(baseCharSpacing+maxSpacingVariation)
+	// Рассчитываем максимальную возможную ширину: символы идут с шагом
+	// не больше (baseCharSpacing+maxSpacingVariation)*maxScale+shearGap(max), последний занимает scaledWidth
+	maxShearGap := c.shearGap(c.maxShear(), c.maxShear())
+	maxTotalWidth := scaledWidth + int(float64((len(chars)-1)*(baseCharSpacing+maxSpacingVariation))*maxScale) + (len(chars)-1)*maxShearGap
 
 	// Берем максимальную ширину для безопасного расчета
 	totalTextWidth := maxTotalWidth
@@ -83,227 +504,341 @@ func (c *ImageCaptcha) Generate(code string) ([]byte, error) {
 
 	// Центрируем текст по горизонтали с проверкой границ
 	startX := (width - totalWidthWithRotation) / 2
-	if startX < maxRotationOffset+10 {
-		startX = maxRotationOffset + 10 // Минимальный отступ с учетом поворота
+	if startX < maxRotationOffset+margin {
+		startX = maxRotationOffset + margin // Минимальный отступ с учетом поворота
 	}
 
 	// Проверяем, не выходит ли текст за правую границу
-	if startX+totalWidthWithRotation > width-10 {
+	if startX+totalWidthWithRotation > width-margin {
 		// Если выходит, уменьшаем начальную позицию
-		startX = width - totalWidthWithRotation - 10
-		if startX < maxRotationOffset+10 {
+		startX = width - totalWidthWithRotation - margin
+		if startX < maxRotationOffset+margin {
 			// Если все равно не помещается, уменьшаем межсимвольные интервалы
-			baseCharSpacing = 20
-			maxSpacingVariation = 3
+			baseCharSpacing = c.px(20)
+			maxSpacingVariation = c.px(3)
+			// Интервал подбираем так, чтобы видимые части символов (около
+			// размера шрифта) поместились в изображение, но не больше обычного
+			// и не меньше минимального: узкие символы при этом не касаются
+			// друг друга, а перекрытие широких покажет анализатор
+			// Случайная вариация сжатого интервала не больше его десятой части,
+			// чтобы соседние символы не сходились ближе минимума
+			if n := len(chars) - 1; n > 0 {
+				available := width - 2*margin - int(float64(c.fontSize)*maxScale) - n*maxShearGap
+				fitted := int(float64(available) / (float64(n) * maxScale))
+				maxSpacingVariation = min(maxSpacingVariation, max(1, fitted/10))
+				baseCharSpacing = max(min(normalSpacing, fitted-maxSpacingVariation), c.px(minCharSpacing))
+			}
 			// Пересчитываем
-			maxTotalWidth = len(code)*charWidth + (len(code)-1)*(baseCharSpacing+maxSpacingVariation)
+			maxTotalWidth = scaledWidth + int(float64((len(chars)-1)*(baseCharSpacing+maxSpacingVariation))*maxScale) + (len(chars)-1)*maxShearGap
 			totalTextWidth = maxTotalWidth
 			totalWidthWithRotation = totalTextWidth + 2*maxRotationOffset
+			// Текст, который не помещается и так, оставляем по центру:
+			// область текста уже включает запас на поворот с обеих сторон,
+			// поэтому прижатый к левому краю текст уходил за правый
 			startX = (width - totalWidthWithRotation) / 2
-			if startX < maxRotationOffset+10 {
-				startX = maxRotationOffset + 10
-			}
 		}
 	}
 
 	charSpacing := baseCharSpacing
-	centerY := height / 2
-
-	// Проверяем вертикальные границы
-	minY := charHeight/2 + maxRotationOffset
-	maxY := height - charHeight/2 - maxRotationOffset
-	if centerY < minY {
-		centerY = minY
-	} else if centerY > maxY {
-		centerY = maxY
-	}
 
-	for i, ch := range code {
-		// Создаем временное изображение для символа
-		charImg := image.NewRGBA(image.Rect(0, 0, charWidth, charHeight))
-
-		// Заполняем прозрачным фоном
-		for x := 0; x < charWidth; x++ {
-			for y := 0; y < charHeight; y++ {
-				charImg.Set(x, y, color.Transparent)
-			}
-		}
-
-		// Рисуем символ во временном изображении
-		charDrawer := &font.Drawer{
-			Dst:  charImg,
-			Src:  image.NewUniform(c.textColor),
-			Face: *c.font,
-			Dot:  fixed.P(8, charHeight/2+int(c.fontSize)/2),
-		}
-		charDrawer.DrawString(string(ch))
+	// Позиция очередного символа с учетом дополнительного пространства для поворота.
+	// Символ масштабируется относительно центра области, поэтому
+	// увеличенный символ выходит за ее левую границу
+	posX := startX + maxRotationOffset + (scaledWidth-charWidth)/2
 
-		// Применяем случайный поворот (-20 до +20 градусов)
-		angle := (rand.Float64()*40 - 20) * math.Pi / 180 // -20° to +20° in radians
+	glyphs := make([]glyph, 0, len(chars))
+	for i, ch := range chars {
+		// Применяем случайный поворот (-maxRotation до +maxRotation градусов)
+		angle := (rand.Float64()*2*maxRotation - maxRotation) * math.Pi / 180
 
-		// Добавляем случайное вертикальное смещение (-5 до +5 пикселей)
-		verticalOffset := rand.Intn(11) - 5 // -5 to +5
+		// Добавляем случайное вертикальное смещение (-5 до +5 логических пикселей)
+		maxVerticalOffset := c.px(5)
+		verticalOffset := rand.Intn(2*maxVerticalOffset+1) - maxVerticalOffset
 
-		// Вычисляем позицию для вставки повернутого символа
-		// Учитываем дополнительное пространство для поворота
-		posX := startX + maxRotationOffset + i*charSpacing
 		posY := centerY + verticalOffset
 
-		// Вставляем повернутый символ в основное изображение
-		for x := 0; x < charWidth; x++ {
-			for y := 0; y < charHeight; y++ {
-				// Получаем цвет пикселя из символа
-				r, g, b, a := charImg.At(x, y).RGBA()
-				if a > 0 {
-					// Вычисляем координаты относительно центра символа
-					relX := float64(x - charWidth/2)
-					relY := float64(y - charHeight/2)
-
-					// Применяем вращение
-					rotX := relX*math.Cos(angle) - relY*math.Sin(angle)
-					rotY := relX*math.Sin(angle) + relY*math.Cos(angle)
-
-					// Возвращаем к абсолютным координатам с учетом смещения
-					destX := int(rotX) + posX + charWidth/2
-					destY := int(rotY) + posY
-
-					// Проверяем границы и рисуем пиксель
-					if destX >= 0 && destX < width && destY >= 0 && destY < height {
-						// Также проверяем, что пиксель не слишком близко к краю
-						// (оставляем запас в 2 пикселя для искажений)
-						if destX >= 2 && destX < width-2 && destY >= 2 && destY < height-2 {
-							img.Set(destX, destY, color.RGBA{
-								R: uint8(r >> 8),
-								G: uint8(g >> 8),
-								B: uint8(b >> 8),
-								A: uint8(a >> 8),
-							})
-						}
-					}
-				}
-			}
+		if !unicode.IsSpace(ch) {
+			glyphs = append(glyphs, glyph{char: ch, x: posX, y: posY, angle: angle, size: sizes[i], shear: shears[i]})
 		}
 
 		// Добавляем небольшую случайную вариацию в межсимвольный интервал
 		spacingVariation := rand.Intn(2*maxSpacingVariation+1) - maxSpacingVariation // -maxSpacingVariation to +maxSpacingVariation
 		charSpacing = baseCharSpacing + spacingVariation
 
-		// Проверяем, не выйдет ли следующий символ за границы
-		if i < len(code)-1 {
-			nextPosX := posX + charWidth + charSpacing
-			if nextPosX+charWidth+maxRotationOffset > width-10 {
+		// Проверяем, не выйдут ли видимые части следующего символа за границы
+		if i < len(chars)-1 {
+			nextPosX := posX + charSpacing
+			if nextPosX+charWidth/2+int(float64(c.fontSize)*maxScale)/2 > width-margin {
 				// Уменьшаем интервал для последующих символов
-				charSpacing = 15
-				maxSpacingVariation = 2
+				charSpacing = min(charSpacing, c.px(15))
+				maxSpacingVariation = c.px(2)
 			}
 		}
+
+		// Шаг накапливается: при умножении номера символа на меняющийся
+		// интервал соседние символы могли наезжать друг на друга.
+		// Интервал растет вместе с масштабом и наклоном соседних символов
+		if i < len(chars)-1 {
+			posX += int(math.Round(float64(charSpacing)*(sizes[i]+sizes[i+1])/2)) + c.shearGap(shears[i], shears[i+1])
+		}
 	}
 
-	// Добавляем случайные помехи - точки
-	for i := 0; i < 100; i++ {
-		x := rand.Intn(width)
-		y := rand.Intn(height)
-		img.Set(x, y, color.RGBA{
-			R: uint8(rand.Intn(256)),
-			G: uint8(rand.Intn(256)),
-			B: uint8(rand.Intn(256)),
-			A: 255,
-		})
+	return glyphs
+}
+
+// scene содержит все случайные элементы одной капчи,
+// чтобы их можно было нарисовать на нескольких кадрах
+type scene struct {
+	background *image.RGBA
+	glyphs     []glyph
+	noise      *noise
+	distortion *distortion
+
+	// Первый кадр и раскладка символов, построенные при проверке качества.
+	// Пусты, если сцена не проверялась
+	frame   *image.RGBA
+	layouts []GlyphLayout
+}
+
+// newScene генерирует фон, расположение символов и помехи для кода
+func (c *ImageCaptcha) newScene(code string) *scene {
+	return c.newSceneWithOverlap(code, c.charOverlap)
+}
+
+// newSceneWithOverlap генерирует сцену с заданным наложением символов
+// в плотной раскладке (в пикселях)
+func (c *ImageCaptcha) newSceneWithOverlap(code string, overlap int) *scene {
+	s := &scene{
+		background: c.newBackground(),
+		// Работаем с символами, а не с байтами: код может содержать не-ASCII символы (например, "×")
+		glyphs: c.layout([]rune(code), overlap),
 	}
+	c.assignGlyphColors(s)
+	// Помехи создаем после расстановки символов: кривые проходят через полосу текста
+	s.noise = c.newNoise(s.glyphs)
+	s.distortion = c.newDistortion(s.glyphs)
+	return s
+}
 
-	// Добавляем случайные линии
-	for i := 0; i < 5; i++ {
-		x1 := rand.Intn(width)
-		y1 := rand.Intn(height)
-		x2 := rand.Intn(width)
-		y2 := rand.Intn(height)
+// newBackground рисует фон капчи
+func (c *ImageCaptcha) newBackground() *image.RGBA {
+	width := c.imageWidth
+	height := c.imageHeight
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
 
-		lineColor := color.RGBA{
-			R: uint8(rand.Intn(256)),
-			G: uint8(rand.Intn(256)),
-			B: uint8(rand.Intn(256)),
-			A: uint8(rand.Intn(100) + 100),
-		}
+	// В прозрачном режиме изображение остается прозрачным
+	if c.transparent {
+		return img
+	}
 
-		// Простая реализация линии
-		dx := abs(x2 - x1)
-		dy := abs(y2 - y1)
-		sx := -1
-		if x1 < x2 {
-			sx = 1
-		}
-		sy := -1
-		if y1 < y2 {
-			sy = 1
-		}
-		err := dx - dy
+	if c.background != nil {
+		c.background.Draw(img, c.scale)
+		return img
+	}
 
-		for {
-			if x1 >= 0 && x1 < width && y1 >= 0 && y1 < height {
-				img.Set(x1, y1, lineColor)
-			}
-			if x1 == x2 && y1 == y2 {
-				break
-			}
-			e2 := 2 * err
-			if e2 > -dy {
-				err -= dy
-				x1 += sx
-			}
-			if e2 < dx {
-				err += dx
-				y1 += sy
-			}
+	// Заполняем фон
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, c.backgroundColor)
 		}
 	}
 
-	// Добавляем волнообразное искажение текста
-	distorted := image.NewRGBA(image.Rect(0, 0, width, height))
-	for x := 0; x < width; x++ {
-		// Более сложное искажение с двумя синусоидами
-		offset1 := int(3 * math.Sin(float64(x)*0.08))
-		offset2 := int(2 * math.Sin(float64(x)*0.15+1.5))
-		offset := offset1 + offset2
+	return img
+}
 
-		for y := 0; y < height; y++ {
-			srcY := y + offset
-			if srcY >= 0 && srcY < height {
-				distorted.Set(x, y, img.At(x, srcY))
-			} else {
-				distorted.Set(x, y, c.backgroundColor)
+// render рисует кадр капчи: фон, символы, помехи и искажение.
+// Номер кадра используется анимированным режимом для движения помех
+func (c *ImageCaptcha) render(s *scene, frame int) *image.RGBA {
+	img := image.NewRGBA(s.background.Rect)
+	copy(img.Pix, s.background.Pix)
+
+	// Рисуем текст капчи с поворотом и смещением символов
+	for _, g := range s.glyphs {
+		c.drawGlyph(img, g, c.textArea())
+	}
+
+	s.noise.draw(img, frame)
+
+	return c.distort(img, s.background, s.distortion, float64(frame)*animationPhaseStep)
+}
+
+// textArea возвращает область, в которой рисуются символы:
+// у краев изображения оставляем запас в 2 логических пикселя для искажений
+func (c *ImageCaptcha) textArea() image.Rectangle {
+	edge := c.px(2)
+	return image.Rect(edge, edge, c.imageWidth-edge, c.imageHeight-edge)
+}
+
+// drawGlyph рисует повернутый символ на изображении в пределах области clip
+func (c *ImageCaptcha) drawGlyph(img *image.RGBA, g glyph, clip image.Rectangle) {
+	charWidth := c.charWidth
+	charHeight := c.charHeight
+
+	// Рисуем символ выбранным стилем во временном изображении
+	charImg, size := c.glyphImage(g)
+
+	// Центр символа во временном и в основном изображении
+	srcCenterX := float64(charWidth / 2)
+	srcCenterY := float64(charHeight / 2)
+	dstCenterX := float64(g.x + charWidth/2)
+	dstCenterY := float64(g.y)
+
+	// Область основного изображения, которую может занять повернутый,
+	// масштабированный и наклоненный символ
+	radius := c.glyphRadius(charImg.Rect, size, g.shear)
+	minX := max(int(dstCenterX)-radius, clip.Min.X)
+	maxX := min(int(dstCenterX)+radius, clip.Max.X-1)
+	minY := max(int(dstCenterY)-radius, clip.Min.Y)
+	maxY := min(int(dstCenterY)+radius, clip.Max.Y-1)
+
+	sin, cos := math.Sincos(g.angle)
+
+	// Вставляем повернутый символ в основное изображение обратным отображением:
+	// для каждого пикселя результата находим точку во временном изображении
+	// и берем ее цвет с интерполяцией. Так в повернутом символе нет дыр,
+	// а сглаженные края смешиваются с фоном.
+	// Прямое преобразование: масштаб, затем наклон, затем поворот (см. glyphPoint)
+	for destY := minY; destY <= maxY; destY++ {
+		for destX := minX; destX <= maxX; destX++ {
+			// Координаты относительно центра символа
+			relX := float64(destX) - dstCenterX
+			relY := float64(destY) - dstCenterY
+
+			// Применяем обратное вращение, убираем наклон и масштаб
+			rotX := relX*cos + relY*sin
+			rotY := -relX*sin + relY*cos
+			srcX := (rotX+g.shear*rotY)/size + srcCenterX
+			srcY := rotY/size + srcCenterY
+
+			pixel := c.sample(charImg, srcX, srcY)
+			if pixel[3] > 0 {
+				blendPixel(img, destX, destY, pixel)
 			}
 		}
 	}
+}
 
-	// Добавляем легкое горизонтальное искажение
-	finalImage := image.NewRGBA(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		// Небольшое горизонтальное смещение
-		horizOffset := int(2 * math.Sin(float64(y)*0.1))
-		for x := 0; x < width; x++ {
-			srcX := x + horizOffset
-			if srcX >= 0 && srcX < width {
-				finalImage.Set(x, y, distorted.At(srcX, y))
-			} else {
-				finalImage.Set(x, y, c.backgroundColor)
-			}
+// glyphRadius возвращает расстояние от центра символа, дальше которого
+// не выходит символ из ячейки cell, перенесенный с масштабом size и наклоном shear
+func (c *ImageCaptcha) glyphRadius(cell image.Rectangle, size, shear float64) int {
+	centerX := float64(c.charWidth / 2)
+	centerY := float64(c.charHeight / 2)
+	reach := 0.0
+	for _, x := range []int{cell.Min.X, cell.Max.X} {
+		for _, y := range []int{cell.Min.Y, cell.Max.Y} {
+			reach = math.Max(reach, math.Hypot(float64(x)-centerX, float64(y)-centerY))
 		}
 	}
+	return int(math.Ceil(reach*size*(1+math.Abs(shear)))) + 1
+}
 
-	// Кодируем изображение в PNG
-	var buf bytes.Buffer
-	err := png.Encode(&buf, finalImage)
-	if err != nil {
-		return nil, err
+// sample возвращает цвет изображения в дробной точке выбранным методом интерполяции
+func (c *ImageCaptcha) sample(img *image.RGBA, x, y float64) [4]float64 {
+	if c.interpolation == InterpolationBicubic {
+		return sampleBicubic(img, x, y)
 	}
+	return sampleBilinear(img, x, y)
+}
 
-	return buf.Bytes(), nil
+// distortion содержит случайные параметры искажения одной капчи:
+// волны и дополнительные стадии. Все смещения заданы в физических пикселях
+type distortion struct {
+	vertical   []wave // Вертикальные смещения столбцов
+	horizontal []wave // Горизонтальные смещения строк
+	warps      []warp
 }
 
-// Вспомогательная функция для абсолютного значения
-func abs(x int) int {
-	if x < 0 {
-		return -x
+// wave — синусоидальная составляющая волнового искажения
+type wave struct {
+	amplitude float64 // Пикселей
+	frequency float64 // Радиан на пиксель
+	phase     float64
+}
+
+// offset возвращает смещение в точке t со сдвигом фазы phase
+func (w wave) offset(t, phase float64) float64 {
+	return w.amplitude * math.Sin(t*w.frequency+w.phase+phase)
+}
+
+// waveSum складывает смещения нескольких волн
+func waveSum(waves []wave, t, phase float64) float64 {
+	sum := 0.0
+	for _, w := range waves {
+		sum += w.offset(t, phase)
+	}
+	return sum
+}
+
+const (
+	// Количество вертикальных и горизонтальных волн
+	verticalWaves   = 2
+	horizontalWaves = 1
+	// Горизонтальные волны слабее вертикальных, чтобы символы не наезжали друг на друга
+	horizontalWaveRatio = 0.6
+)
+
+// newDistortion выбирает случайные параметры волн в заданных диапазонах
+// и создает стадии искажения для расположения символов glyphs
+func (c *ImageCaptcha) newDistortion(glyphs []glyph) *distortion {
+	d := &distortion{}
+	for i := 0; i < verticalWaves; i++ {
+		d.vertical = append(d.vertical, c.randomWave(1))
+	}
+	for i := 0; i < horizontalWaves; i++ {
+		d.horizontal = append(d.horizontal, c.randomWave(horizontalWaveRatio))
+	}
+	d.warps = c.newWarps(glyphs)
+	return d
+}
+
+// randomWave возвращает волну со случайными амплитудой, частотой и фазой.
+// Диапазоны заданы в логических пикселях, амплитуда дополнительно
+// умножается на DistortionScale и ratio
+func (c *ImageCaptcha) randomWave(ratio float64) wave {
+	amplitude := c.waveAmplitudeMin + rand.Float64()*(c.waveAmplitudeMax-c.waveAmplitudeMin)
+	frequency := c.waveFrequencyMin + rand.Float64()*(c.waveFrequencyMax-c.waveFrequencyMin)
+	return wave{
+		amplitude: amplitude * c.distortionScale * ratio * c.scale,
+		frequency: frequency / c.scale,
+		phase:     rand.Float64() * 2 * math.Pi,
 	}
-	return x
+}
+
+// source возвращает точку неискаженного изображения, из которой берется
+// пиксель (x, y) искаженного: сначала обращаются волны, затем стадии warps
+func (d *distortion) source(x, y, phase float64) (float64, float64) {
+	x += waveSum(d.horizontal, y, phase)
+	y += waveSum(d.vertical, x, phase)
+	return warpSource(d.warps, x, y)
+}
+
+// target переносит точку неискаженного изображения так же, как ее переносит distort
+func (d *distortion) target(x, y, phase float64) (float64, float64) {
+	x, y = warpTarget(d.warps, x, y)
+	y -= waveSum(d.vertical, x, phase)
+	x -= waveSum(d.horizontal, y, phase)
+	return x, y
+}
+
+// distort применяет искажение d за один проход с интерполяцией.
+// Открывшиеся у краев области заполняются фоном, сдвиг фазы
+// позволяет менять искажение между кадрами анимации
+func (c *ImageCaptcha) distort(img, background *image.RGBA, d *distortion, phase float64) *image.RGBA {
+	bounds := img.Bounds()
+	maxX := float64(bounds.Dx() - 1)
+	maxY := float64(bounds.Dy() - 1)
+
+	distorted := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			sx, sy := d.source(float64(x), float64(y), phase)
+			if sx < 0 || sy < 0 || sx > maxX || sy > maxY {
+				setPixel(distorted, x, y, pixelAt(background, x, y))
+				continue
+			}
+			setPixel(distorted, x, y, c.sample(img, sx, sy))
+		}
+	}
+
+	return distorted
 }
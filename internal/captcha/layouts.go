@@ -0,0 +1,281 @@
+package captcha
+
+import (
+	"math"
+	"math/rand"
+	"unicode"
+
+	"golang.org/x/image/font"
+)
+
+// Layout задает расположение символов на изображении
+type Layout int
+
+const (
+	// Символы в одну или несколько горизонтальных строк (по умолчанию)
+	LayoutLine Layout = iota
+	// Символы друг под другом сверху вниз
+	LayoutVertical
+	// Символы вдоль дуги окружности, повернутые по касательной к ней
+	LayoutArc
+	// Символы по кругу по часовой стрелке начиная сверху, без поворота по касательной
+	LayoutCircle
+	// Символы в случайных местах изображения, не касаясь друг друга (см. ClickCaptcha)
+	LayoutScatter
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutLine:
+		return "line"
+	case LayoutVertical:
+		return "vertical"
+	case LayoutArc:
+		return "arc"
+	case LayoutCircle:
+		return "circle"
+	case LayoutScatter:
+		return "scatter"
+	default:
+		return "unknown"
+	}
+}
+
+// Параметры раскладок в долях размера шрифта
+const (
+	verticalSpacing = 1.1  // Шаг символов по вертикали
+	arcSpacing      = 0.85 // Шаг символов вдоль дуги и окружности
+
+	// Наибольший угловой размер дуги (радиан)
+	maxTextArcSweep = math.Pi / 2
+
+	// Радиус круга, в который помещается повернутый символ
+	scatterRadius = 0.6
+)
+
+// Количество попыток поставить символ в случайное место,
+// прежде чем уменьшить расстояние между символами
+const scatterAttempts = 100
+
+// Количество уменьшений расстояния, после которых символы
+// ставятся без ограничения расстояния
+const scatterRounds = 30
+
+// shapedLayout располагает символы по выбранной раскладке, отличной от LayoutLine.
+// Пробелы и переводы строк в таких раскладках не учитываются
+func (c *ImageCaptcha) shapedLayout(chars []rune) []glyph {
+	visible := make([]rune, 0, len(chars))
+	for _, ch := range chars {
+		if !unicode.IsSpace(ch) {
+			visible = append(visible, ch)
+		}
+	}
+	if len(visible) == 0 {
+		return nil
+	}
+
+	switch c.textLayout {
+	case LayoutVertical:
+		return c.verticalLayout(visible)
+	case LayoutArc:
+		return c.arcLayout(visible)
+	case LayoutScatter:
+		return c.scatterLayout(visible)
+	default:
+		return c.circleLayout(visible)
+	}
+}
+
+// placeGlyph создает символ, видимая часть которого центрирована в точке (x, y)
+func (c *ImageCaptcha) placeGlyph(ch rune, x, y, angle float64) glyph {
+	size, shear := c.randomShape()
+	dx, dy := c.inkCenter(ch)
+	return glyph{
+		char:  ch,
+		x:     int(math.Round(x - float64(c.charWidth)/2 - dx*size)),
+		y:     int(math.Round(y - dy*size)),
+		angle: angle,
+		size:  size,
+		shear: shear,
+	}
+}
+
+// inkCenter возвращает смещение центра видимой части символа
+// от центра его временного изображения
+func (c *ImageCaptcha) inkCenter(ch rune) (float64, float64) {
+	bounds, _ := font.BoundString(*c.font, string(ch))
+	if bounds.Empty() {
+		return 0, 0
+	}
+	originX, originY := c.glyphOrigin()
+	x := float64(originX) + float64(bounds.Min.X+bounds.Max.X)/128
+	y := float64(originY) + float64(bounds.Min.Y+bounds.Max.Y)/128
+	return x - float64(c.charWidth)/2, y - float64(c.charHeight)/2
+}
+
+// randomAngle возвращает случайный поворот символа в пределах доли MaxRotation
+func (c *ImageCaptcha) randomAngle(fraction float64) float64 {
+	return (rand.Float64()*2 - 1) * c.maxRotation * fraction * math.Pi / 180
+}
+
+// inkSize возвращает наибольший размер видимой части символа
+// с учетом масштабирования
+func (c *ImageCaptcha) inkSize() float64 {
+	return float64(c.fontSize) * capHeightRatio * c.charScaleMax
+}
+
+// verticalLayout ставит символы столбцом по центру изображения.
+// Если столбец не помещается по высоте, шаг уменьшается, но не меньше
+// высоты символа с небольшим зазором
+func (c *ImageCaptcha) verticalLayout(chars []rune) []glyph {
+	margin := float64(c.px(10))
+	ink := c.inkSize()
+
+	step := float64(c.fontSize) * verticalSpacing * c.charScaleMax
+	if n := len(chars); n > 1 {
+		available := (float64(c.imageHeight) - 2*margin - ink) / float64(n-1)
+		step = math.Max(math.Min(step, available), ink+float64(c.px(4)))
+	}
+
+	maxOffset := c.px(3)
+	top := float64(c.imageHeight)/2 - float64(len(chars)-1)*step/2
+	glyphs := make([]glyph, 0, len(chars))
+	for i, ch := range chars {
+		x := float64(c.imageWidth)/2 + float64(rand.Intn(2*maxOffset+1)-maxOffset)
+		glyphs = append(glyphs, c.placeGlyph(ch, x, top+float64(i)*step, c.randomAngle(1)))
+	}
+	return glyphs
+}
+
+// arcLayout ставит символы вдоль дуги окружности, выпуклой вверх или вниз.
+// Радиус подбирается так, чтобы дуга помещалась в изображение: чем шире
+// изображение относительно длины текста, тем сильнее изгиб
+func (c *ImageCaptcha) arcLayout(chars []rune) []glyph {
+	margin := float64(c.px(10))
+	ink := c.inkSize()
+	width := float64(c.imageWidth) - 2*margin - ink
+	height := float64(c.imageHeight) - 2*margin - ink
+
+	// Длина дуги между центрами крайних символов
+	length := float64(len(chars)-1) * float64(c.fontSize) * arcSpacing * c.charScaleMax
+	if length == 0 {
+		return []glyph{c.placeGlyph(chars[0], float64(c.imageWidth)/2, float64(c.imageHeight)/2, c.randomAngle(1))}
+	}
+
+	// Начинаем с наибольшего изгиба и уменьшаем его, пока дуга не поместится по высоте
+	sweep := maxTextArcSweep
+	radius := length / sweep
+	for sweep > 0.05 && radius*(1-math.Cos(sweep/2)) > height {
+		sweep *= 0.9
+		radius = length / sweep
+	}
+	if chord := 2 * radius * math.Sin(sweep/2); chord > width && width > 0 {
+		// Сжимаем текст вдоль дуги, сохраняя изгиб
+		radius *= width / chord
+	}
+
+	// Центр окружности выбираем так, чтобы дуга была по центру изображения
+	// по вертикали: выпуклая вверх дуга — над центром окружности, вниз — под ним
+	sagitta := radius * (1 - math.Cos(sweep/2))
+	up := rand.Intn(2) == 0
+	cx := float64(c.imageWidth) / 2
+	cy := float64(c.imageHeight)/2 - sagitta/2 + radius
+	if !up {
+		cy = float64(c.imageHeight)/2 + sagitta/2 - radius
+	}
+
+	glyphs := make([]glyph, 0, len(chars))
+	for i, ch := range chars {
+		theta := sweep * (float64(i)/float64(len(chars)-1) - 0.5)
+		sin, cos := math.Sincos(theta)
+		x, y, angle := cx+radius*sin, cy-radius*cos, theta
+		if !up {
+			y, angle = cy+radius*cos, -theta
+		}
+		glyphs = append(glyphs, c.placeGlyph(ch, x, y, angle+c.randomAngle(0.5)))
+	}
+	return glyphs
+}
+
+// circleLayout ставит символы по окружности через равные углы, начиная
+// сверху и по часовой стрелке. Символы остаются вертикальными, чтобы
+// нижние не оказались перевернутыми
+func (c *ImageCaptcha) circleLayout(chars []rune) []glyph {
+	margin := float64(c.px(10))
+	ink := c.inkSize()
+
+	// Радиус, при котором соседние символы не касаются друг друга,
+	// но не больше, чем позволяет изображение
+	limit := (math.Min(float64(c.imageWidth), float64(c.imageHeight)) - 2*margin - ink) / 2
+	radius := 0.0
+	if n := len(chars); n > 1 {
+		chord := float64(c.fontSize) * arcSpacing * c.charScaleMax
+		radius = math.Min(chord/(2*math.Sin(math.Pi/float64(n))), limit)
+		radius = math.Max(radius, limit/2)
+	}
+
+	cx := float64(c.imageWidth) / 2
+	cy := float64(c.imageHeight) / 2
+	glyphs := make([]glyph, 0, len(chars))
+	for i, ch := range chars {
+		theta := 2 * math.Pi * float64(i) / float64(len(chars))
+		sin, cos := math.Sincos(theta)
+		glyphs = append(glyphs, c.placeGlyph(ch, cx+radius*sin, cy-radius*cos, c.randomAngle(1)))
+	}
+	return glyphs
+}
+
+// scatterLayout ставит символы в случайные места изображения так,
+// чтобы круги вокруг символов не пересекались. Если символы не удается
+// расставить, расстояние между ними постепенно уменьшается, а в слишком
+// маленьком изображении, где все центры совпадают, перестает проверяться
+func (c *ImageCaptcha) scatterLayout(chars []rune) []glyph {
+	margin := float64(c.px(10))
+	radius := float64(c.fontSize) * scatterRadius * c.charScaleMax
+
+	// Область, в которой могут находиться центры символов
+	minX, maxX := margin+radius, float64(c.imageWidth)-margin-radius
+	minY, maxY := margin+radius, float64(c.imageHeight)-margin-radius
+	if minX > maxX {
+		minX, maxX = float64(c.imageWidth)/2, float64(c.imageWidth)/2
+	}
+	if minY > maxY {
+		minY, maxY = float64(c.imageHeight)/2, float64(c.imageHeight)/2
+	}
+
+	distance := 2 * radius
+	for round := 1; ; round++ {
+		centers := make([]point, 0, len(chars))
+		for range chars {
+			for attempt := 0; attempt < scatterAttempts; attempt++ {
+				p := point{minX + rand.Float64()*(maxX-minX), minY + rand.Float64()*(maxY-minY)}
+				if scatterFits(centers, p, distance) {
+					centers = append(centers, p)
+					break
+				}
+			}
+		}
+
+		if len(centers) == len(chars) {
+			glyphs := make([]glyph, 0, len(chars))
+			for i, ch := range chars {
+				glyphs = append(glyphs, c.placeGlyph(ch, centers[i].x, centers[i].y, c.randomAngle(1)))
+			}
+			return glyphs
+		}
+		distance *= 0.9
+		if round >= scatterRounds {
+			distance = 0
+		}
+	}
+}
+
+// scatterFits проверяет, что точка p не ближе distance ни к одной из точек
+func scatterFits(centers []point, p point, distance float64) bool {
+	for _, q := range centers {
+		if math.Hypot(p.x-q.x, p.y-q.y) < distance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package captcha
+
+import (
+	"math"
+	"unicode"
+)
+
+// Расстояние между строками текста в долях размера шрифта
+const lineSpacing = 1.2
+
+// textLines делит код на строки. Явные переводы строки имеют приоритет,
+// иначе количество строк задается Lines или выбирается по пропорциям
+// изображения и длине текста
+func (c *ImageCaptcha) textLines(chars []rune) [][]rune {
+	var lines [][]rune
+	start := 0
+	for i, ch := range chars {
+		if ch == '\n' {
+			lines = appendLine(lines, chars[start:i])
+			start = i + 1
+		}
+	}
+	if start > 0 {
+		return appendLine(lines, chars[start:])
+	}
+
+	count := c.lines
+	if count <= 0 {
+		count = 1
+		if c.imageHeight > c.imageWidth && visibleChars(chars) > 1 {
+			count = 2
+		}
+		// Строка, которая не помещается по ширине даже со сжатыми интервалами,
+		// делится на несколько, пока строки с запасом на поворот крайних
+		// символов помещаются по высоте
+		rotationMargin := int(float64(c.fontSize) * c.charScaleMax * math.Sin(c.maxRotation*math.Pi/180))
+		for !c.crowded && count < visibleChars(chars) && (count+1)*c.lineStep()+2*rotationMargin <= c.imageHeight &&
+			!c.lineFits(longestLine(splitLines(chars, count))) {
+			count++
+		}
+	}
+	return splitLines(chars, count)
+}
+
+// lineFits проверяет, что строка из n символов помещается по ширине
+// при сжатых интервалах lineLayout. Интервал берется не меньше размера шрифта:
+// при более плотном интервале повернутые символы заходят друг на друга
+func (c *ImageCaptcha) lineFits(n int) bool {
+	spacing := float64(max(c.px(minCharSpacing), c.fontSize)+c.px(3)) * c.charScaleMax
+	shearGap := c.shearGap(c.maxShear(), c.maxShear())
+	width := int(float64(c.fontSize)*c.charScaleMax) + int(float64(n-1)*spacing) + (n-1)*shearGap
+	return width <= c.imageWidth-2*c.px(10)
+}
+
+// longestLine возвращает длину самой длинной строки в символах
+func longestLine(lines [][]rune) int {
+	n := 0
+	for _, line := range lines {
+		n = max(n, len(line))
+	}
+	return n
+}
+
+// splitLines делит текст на count строк примерно равной длины.
+// Строка разрывается на пробеле, ближайшем к расчетной границе, а без пробелов —
+// на самой границе
+func splitLines(chars []rune, count int) [][]rune {
+	var lines [][]rune
+	for ; count > 1 && len(chars) > 1; count-- {
+		target := (len(chars) + count - 1) / count
+		cut, skip := target, 0
+		for i, ch := range chars {
+			if unicode.IsSpace(ch) && (skip == 0 || abs(i-target) < abs(cut-target)) {
+				cut, skip = i, 1
+			}
+		}
+		lines = appendLine(lines, chars[:cut])
+		chars = chars[cut+skip:]
+	}
+	return appendLine(lines, chars)
+}
+
+// appendLine добавляет строку без пробелов по краям, пропуская пустые
+func appendLine(lines [][]rune, line []rune) [][]rune {
+	for len(line) > 0 && unicode.IsSpace(line[0]) {
+		line = line[1:]
+	}
+	for len(line) > 0 && unicode.IsSpace(line[len(line)-1]) {
+		line = line[:len(line)-1]
+	}
+	if len(line) == 0 {
+		return lines
+	}
+	return append(lines, line)
+}
+
+// visibleChars возвращает количество символов, кроме пробелов
+func visibleChars(chars []rune) int {
+	n := 0
+	for _, ch := range chars {
+		if !unicode.IsSpace(ch) {
+			n++
+		}
+	}
+	return n
+}
+
+// glyphExtent возвращает наибольшие размеры области символа с учетом
+// масштабирования и смещение его краев из-за поворота и наклона
+func (c *ImageCaptcha) glyphExtent() (width, height, rotationOffset int) {
+	width = int(math.Ceil(float64(c.charWidth) * c.charScaleMax))
+	height = int(math.Ceil(float64(c.charHeight) * c.charScaleMax))
+
+	// Диагональ символа * sin(угла)
+	diagonal := math.Sqrt(float64(width*width + height*height))
+	rotationOffset = int(diagonal * math.Sin(c.maxRotation*math.Pi/180))
+	// Наклон сдвигает верх и низ символа в стороны
+	rotationOffset += int(math.Ceil(c.maxShear() * float64(height) / 2))
+	return width, height, rotationOffset
+}
+
+// lineCenter возвращает вертикальный центр единственной строки:
+// середину изображения, сдвинутую так, чтобы повернутые символы
+// и прогиб базовой линии не выходили за край. Если строка выше
+// изображения, она остается по центру и выходит за оба края поровну
+func (c *ImageCaptcha) lineCenter() int {
+	_, height, rotationOffset := c.glyphExtent()
+	curveOffset := int(math.Ceil(c.maxBaselineCurve() / 2))
+
+	centerY := c.imageHeight / 2
+	minY := height/2 + rotationOffset + curveOffset
+	maxY := c.imageHeight - height/2 - rotationOffset - curveOffset
+	if minY > maxY {
+		return centerY
+	}
+	if centerY < minY {
+		centerY = minY
+	} else if centerY > maxY {
+		centerY = maxY
+	}
+	return centerY
+}
+
+// lineStep возвращает расстояние между центрами соседних строк: высота строки
+// с запасом на случайное вертикальное смещение символов и прогиб базовой линии
+func (c *ImageCaptcha) lineStep() int {
+	curveOffset := int(math.Ceil(c.maxBaselineCurve() / 2))
+	return int(math.Ceil(float64(c.fontSize)*lineSpacing*c.charScaleMax)) + 2*c.px(5) + 2*curveOffset
+}
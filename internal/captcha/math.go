@@ -0,0 +1,179 @@
+package captcha
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// MathCaptchaConfig задает параметры арифметической капчи
+type MathCaptchaConfig struct {
+	MaxOperand int    // Максимальное значение операнда (по умолчанию 9)
+	Operands   int    // Количество операндов в выражении (по умолчанию 3)
+	Operators  string // Допустимые операции из "+-×" (по умолчанию все)
+}
+
+const (
+	defaultMathMaxOperand = 9
+	defaultMathOperands   = 3
+	defaultMathOperators  = "+-×"
+)
+
+// MathCaptcha показывает арифметическое выражение вида "7 + 4 × 2",
+// отрисованное через ImageCaptcha, и ожидает в ответ его значение
+type MathCaptcha struct {
+	image      *ImageCaptcha
+	maxOperand int
+	operands   int
+	operators  []rune
+}
+
+func NewMathCaptcha(image *ImageCaptcha, config MathCaptchaConfig) *MathCaptcha {
+	c := &MathCaptcha{
+		image:      image,
+		maxOperand: config.MaxOperand,
+		operands:   config.Operands,
+	}
+
+	if c.maxOperand <= 0 {
+		c.maxOperand = defaultMathMaxOperand
+	}
+	if c.operands < 2 {
+		c.operands = defaultMathOperands
+	}
+
+	// Оставляем только поддерживаемые операции
+	for _, op := range config.Operators {
+		if strings.ContainsRune(defaultMathOperators, op) {
+			c.operators = append(c.operators, op)
+		}
+	}
+	if len(c.operators) == 0 {
+		c.operators = []rune(defaultMathOperators)
+	}
+
+	return c
+}
+
+// Generate отрисовывает переданное выражение
+func (c *MathCaptcha) Generate(expression string) ([]byte, error) {
+	return c.image.Generate(expression)
+}
+
+// NewChallenge генерирует случайное выражение и возвращает изображение,
+// отображаемый текст и ожидаемый ответ
+func (c *MathCaptcha) NewChallenge() (image []byte, text string, answer string, err error) {
+	text, value, err := c.Expression()
+	if err != nil {
+		return nil, "", "", err
+	}
+	image, err = c.Generate(text)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return image, text, strconv.Itoa(value), nil
+}
+
+// Expression генерирует случайное выражение с неотрицательным результатом.
+// Выражение строится за один проход: каждое вычитаемое не больше накопленной
+// суммы за вычетом единицы на каждое следующее вычитание. Если места
+// для вычитания не осталось, оно заменяется сложением; без сложения
+// среди допустимых операций возвращается ошибка
+func (c *MathCaptcha) Expression() (string, int, error) {
+	operands := make([]int, c.operands)
+	operators := make([]rune, c.operands-1)
+	pending := 0 // Количество еще не выбранных вычитаемых
+	for i := range operators {
+		operators[i] = c.operators[rand.Intn(len(c.operators))]
+		if operators[i] == '-' {
+			pending++
+		}
+	}
+
+	// Умножение связывает сильнее, поэтому вычитается все произведение
+	// целиком: sum — сумма завершенных слагаемых, term — текущее слагаемое,
+	// limit — наибольшее значение текущего вычитаемого
+	sum, term, limit := 0, 0, 0
+	subtract := false
+	for i := range operands {
+		if i > 0 && operators[i-1] != '×' {
+			if subtract {
+				sum -= term
+			} else {
+				sum += term
+			}
+
+			subtract = operators[i-1] == '-'
+			if subtract {
+				pending--
+				limit = sum - pending
+				if limit < 1 {
+					if !strings.ContainsRune(string(c.operators), '+') {
+						return "", 0, fmt.Errorf("captcha: cannot build a non-negative expression of %d operands with operators %q",
+							c.operands, string(c.operators))
+					}
+					operators[i-1] = '+'
+					subtract = false
+				}
+			}
+			term = 1
+		}
+
+		// Первое число оставляет место для всех вычитаний
+		low, high := 1, c.maxOperand
+		switch {
+		case i == 0:
+			low = min(max(pending, 1), high)
+		case subtract:
+			high = min(high, limit/term)
+		}
+		operands[i] = low + rand.Intn(high-low+1)
+		if i == 0 {
+			term = operands[i]
+		} else {
+			term *= operands[i]
+		}
+	}
+
+	value := evaluateExpression(operands, operators)
+
+	var sb strings.Builder
+	for i, operand := range operands {
+		if i > 0 {
+			sb.WriteRune(' ')
+			sb.WriteRune(operators[i-1])
+			sb.WriteRune(' ')
+		}
+		sb.WriteString(strconv.Itoa(operand))
+	}
+	return sb.String(), value, nil
+}
+
+// evaluateExpression вычисляет значение выражения с учетом приоритета умножения
+func evaluateExpression(operands []int, operators []rune) int {
+	// Сначала сворачиваем умножения в слагаемые
+	terms := []int{operands[0]}
+	signs := []rune{'+'}
+	for i, op := range operators {
+		if op == '×' {
+			terms[len(terms)-1] *= operands[i+1]
+			continue
+		}
+		terms = append(terms, operands[i+1])
+		signs = append(signs, op)
+	}
+
+	// Затем складываем и вычитаем слева направо
+	result := 0
+	for i, term := range terms {
+		if signs[i] == '-' {
+			result -= term
+		} else {
+			result += term
+		}
+	}
+	return result
+}
+
+var _ Captcha = (*MathCaptcha)(nil)
@@ -0,0 +1,387 @@
+package captcha
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// Fingerprint возвращает короткий отпечаток параметров генерации,
+// влияющих на сложность капчи для человека. Отпечаток строится по параметрам
+// после подстановки значений по умолчанию, поэтому незаданный параметр
+// и явно заданное значение по умолчанию дают один отпечаток.
+//
+// В отпечаток не входят:
+//   - Font: растровый шрифт нельзя сравнить по значению, шрифт
+//     с контурами определяется по OutlineFont;
+//   - размеры ячейки символа: они выводятся из Scale
+func (config ImageCaptchaConfig) Fingerprint() string {
+	c := NewImageCaptcha(config)
+
+	fields := []struct {
+		name  string
+		value any
+	}{
+		{"size", fmt.Sprintf("%dx%d", c.imageWidth, c.imageHeight)},
+		{"font", c.fontSize},
+		{"outlinefont", fontKey(c.outlineFont)},
+		{"scale", c.scale},
+		{"colors", paletteKey([]color.Color{c.backgroundColor, c.textColor})},
+		{"transparent", c.transparent},
+		{"background", backgroundKey(c.background)},
+		{"noise", fmt.Sprintf("%d/%d/%d", c.noiseDots, c.noiseLines, c.noiseArcs)},
+		{"linewidth", c.noiseLineWidth},
+		{"palettes", paletteKey(c.noisePalette) + "/" + paletteKey(c.linePalette)},
+		{"bands", fmt.Sprintf("%d/%g/%t", c.bandCurves, c.bandCurveWidth, c.bandTextColor)},
+		{"distortion", c.distortionScale},
+		{"distortions", c.distortions},
+		{"waves", fmt.Sprintf("%g-%g/%g-%g", c.waveAmplitudeMin, c.waveAmplitudeMax, c.waveFrequencyMin, c.waveFrequencyMax)},
+		{"rotation", c.maxRotation},
+		{"shape", fmt.Sprintf("%g-%g/%g-%g/%g-%g", c.charScaleMin, c.charScaleMax, c.shearMin, c.shearMax, c.curveMin, c.curveMax)},
+		{"interpolation", c.interpolation},
+		{"layout", c.textLayout},
+		{"lines", c.lines},
+		{"crowded", fmt.Sprintf("%t/%d", c.crowded, c.charOverlap)},
+		{"style", c.glyphStyle},
+		{"outline", fmt.Sprintf("%g/%s", c.outlineWidth, paletteKey([]color.Color{c.outlineColor}))},
+		{"shadow", fmt.Sprintf("%g/%s", c.shadowOffset, paletteKey([]color.Color{c.shadowColor}))},
+		{"texture", backgroundKey(c.glyphTexture)},
+		{"glyphcolors", glyphColorsKey(c.glyphColors)},
+		{"frames", fmt.Sprintf("%d/%v", c.animationFrames, c.animationDelay)},
+		{"guard", guardKey(c.qualityGuard)},
+	}
+
+	h := sha256.New()
+	for _, f := range fields {
+		fmt.Fprintf(h, "%s=%v;", f.name, f.value)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// paletteKey записывает цвета палитры для отпечатка в виде #rrggbbaa
+func paletteKey(palette []color.Color) string {
+	keys := make([]string, len(palette))
+	for i, c := range palette {
+		if c == nil {
+			keys[i] = "none"
+			continue
+		}
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		keys[i] = fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+	}
+	return strings.Join(keys, ",")
+}
+
+// fontKey записывает шрифт для отпечатка по его полному имени
+func fontKey(f *opentype.Font) string {
+	if f == nil {
+		return "none"
+	}
+	name, err := f.Name(nil, sfnt.NameIDFull)
+	if err != nil {
+		return fmt.Sprintf("glyphs:%d", f.NumGlyphs())
+	}
+	return name
+}
+
+// backgroundKey записывает генератор фона для отпечатка: тип и параметры.
+// Для фрагментов изображений записываются только их размеры
+func backgroundKey(b Background) string {
+	switch b := b.(type) {
+	case nil:
+		return "none"
+	case *ImageBackground:
+		sizes := make([]string, len(b.images))
+		for i, img := range b.images {
+			sizes[i] = fmt.Sprintf("%dx%d", img.Rect.Dx(), img.Rect.Dy())
+		}
+		return "images:" + strings.Join(sizes, ",")
+	default:
+		return fmt.Sprintf("%T%+v", b, b)
+	}
+}
+
+// glyphColorsKey записывает параметры случайных цветов символов для отпечатка
+func glyphColorsKey(gc *GlyphColors) string {
+	if gc == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s/%g-%g/%g-%g/%g-%g/%g", paletteKey(gc.Palette),
+		gc.HueMin, gc.HueMax, gc.SaturationMin, gc.SaturationMax,
+		gc.LightnessMin, gc.LightnessMax, gc.MinContrast)
+}
+
+// guardKey записывает пороги проверки качества для отпечатка
+func guardKey(t *QualityThresholds) string {
+	if t == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%+v", *t)
+}
+
+const (
+	// Время, после которого непроверенная капча считается брошенной
+	defaultPendingTTL = 10 * time.Minute
+	// Максимальное количество хранимых времен решения на пресет
+	maxSolveTimeSamples = 10000
+)
+
+// MetricsCollector собирает статистику прохождения капч людьми:
+// для каждой выданной капчи запоминается отпечаток конфигурации и
+// уровень сложности, а при проверке — результат и время решения
+type MetricsCollector struct {
+	mu         sync.Mutex
+	pending    map[string]issuedChallenge
+	stats      map[presetKey]*presetStats
+	pendingTTL time.Duration
+	lastExpire time.Time // Время последней очистки pending
+	now        func() time.Time
+}
+
+type issuedChallenge struct {
+	key    presetKey
+	issued time.Time
+}
+
+type presetKey struct {
+	difficulty  Difficulty
+	fingerprint string
+}
+
+type presetStats struct {
+	issued     int
+	passed     int
+	failed     int
+	abandoned  int
+	solveTimes []time.Duration // Времена успешных решений
+	next       int             // Позиция для перезаписи при заполненном буфере
+}
+
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		pending:    make(map[string]issuedChallenge),
+		stats:      make(map[presetKey]*presetStats),
+		pendingTTL: defaultPendingTTL,
+		now:        time.Now,
+	}
+}
+
+// Issued регистрирует выданную капчу. Не чаще раза в pendingTTL
+// брошенные капчи удаляются из памяти, даже если Expire не вызывается
+func (m *MetricsCollector) Issued(challengeID string, difficulty Difficulty, fingerprint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastExpire) >= m.pendingTTL {
+		m.expire(now)
+	}
+
+	key := presetKey{difficulty: difficulty, fingerprint: fingerprint}
+	m.pending[challengeID] = issuedChallenge{key: key, issued: now}
+	m.statsFor(key).issued++
+}
+
+// Verified регистрирует результат проверки ответа на капчу.
+// Повторные проверки и неизвестные идентификаторы игнорируются
+func (m *MetricsCollector) Verified(challengeID string, passed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	challenge, ok := m.pending[challengeID]
+	if !ok {
+		return
+	}
+	delete(m.pending, challengeID)
+
+	stats := m.statsFor(challenge.key)
+	if !passed {
+		stats.failed++
+		return
+	}
+
+	stats.passed++
+	solveTime := m.now().Sub(challenge.issued)
+	if len(stats.solveTimes) < maxSolveTimeSamples {
+		stats.solveTimes = append(stats.solveTimes, solveTime)
+	} else {
+		stats.solveTimes[stats.next] = solveTime
+		stats.next = (stats.next + 1) % maxSolveTimeSamples
+	}
+}
+
+// Expire помечает как брошенные капчи, которые не были проверены вовремя.
+// Рекомендуется вызывать периодически
+func (m *MetricsCollector) Expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(m.now())
+}
+
+// expire помечает как брошенные капчи, выданные раньше now - pendingTTL.
+// Вызывается под m.mu
+func (m *MetricsCollector) expire(now time.Time) {
+	m.lastExpire = now
+	for id, challenge := range m.pending {
+		if now.Sub(challenge.issued) > m.pendingTTL {
+			delete(m.pending, id)
+			m.statsFor(challenge.key).abandoned++
+		}
+	}
+}
+
+func (m *MetricsCollector) statsFor(key presetKey) *presetStats {
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = &presetStats{}
+		m.stats[key] = stats
+	}
+	return stats
+}
+
+// PresetReport — агрегированная статистика по пресету
+type PresetReport struct {
+	Difficulty      string        `json:"difficulty"`
+	Fingerprint     string        `json:"fingerprint"`
+	Issued          int           `json:"issued"`
+	Passed          int           `json:"passed"`
+	Failed          int           `json:"failed"`
+	Abandoned       int           `json:"abandoned"`
+	PassRate        float64       `json:"pass_rate"` // Доля успешных среди проверенных
+	MedianSolveTime time.Duration `json:"-"`
+	MeanSolveTime   time.Duration `json:"-"`
+}
+
+// MarshalJSON выводит времена решения в миллисекундах
+func (r PresetReport) MarshalJSON() ([]byte, error) {
+	type plain PresetReport
+	return json.Marshal(struct {
+		plain
+		MedianSolveTimeMs int64 `json:"median_solve_time_ms"`
+		MeanSolveTimeMs   int64 `json:"mean_solve_time_ms"`
+	}{
+		plain:             plain(r),
+		MedianSolveTimeMs: r.MedianSolveTime.Milliseconds(),
+		MeanSolveTimeMs:   r.MeanSolveTime.Milliseconds(),
+	})
+}
+
+// Report возвращает статистику по всем пресетам,
+// упорядоченную по уровню сложности и отпечатку
+func (m *MetricsCollector) Report() []PresetReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := make([]PresetReport, 0, len(m.stats))
+	for key, stats := range m.stats {
+		report := PresetReport{
+			Difficulty:  key.difficulty.String(),
+			Fingerprint: key.fingerprint,
+			Issued:      stats.issued,
+			Passed:      stats.passed,
+			Failed:      stats.failed,
+			Abandoned:   stats.abandoned,
+		}
+		if verified := stats.passed + stats.failed; verified > 0 {
+			report.PassRate = float64(stats.passed) / float64(verified)
+		}
+		if len(stats.solveTimes) > 0 {
+			times := append([]time.Duration(nil), stats.solveTimes...)
+			sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+			var total time.Duration
+			for _, t := range times {
+				total += t
+			}
+			report.MedianSolveTime = times[len(times)/2]
+			report.MeanSolveTime = total / time.Duration(len(times))
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Difficulty != reports[j].Difficulty {
+			return difficultyOrder(reports[i].Difficulty) < difficultyOrder(reports[j].Difficulty)
+		}
+		return reports[i].Fingerprint < reports[j].Fingerprint
+	})
+
+	return reports
+}
+
+// difficultyOrder возвращает порядковый номер уровня сложности по его названию
+func difficultyOrder(name string) int {
+	for d := DifficultyEasy; d <= DifficultyExtreme; d++ {
+		if d.String() == name {
+			return int(d)
+		}
+	}
+	return int(DifficultyExtreme) + 1
+}
+
+// WriteJSON выгружает отчет в формате JSON
+func (m *MetricsCollector) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m.Report())
+}
+
+// WriteCSV выгружает отчет в формате CSV
+func (m *MetricsCollector) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"difficulty", "fingerprint", "issued", "passed", "failed", "abandoned",
+		"pass_rate", "median_solve_time_ms", "mean_solve_time_ms",
+	})
+	for _, r := range m.Report() {
+		writer.Write([]string{
+			r.Difficulty,
+			r.Fingerprint,
+			strconv.Itoa(r.Issued),
+			strconv.Itoa(r.Passed),
+			strconv.Itoa(r.Failed),
+			strconv.Itoa(r.Abandoned),
+			strconv.FormatFloat(r.PassRate, 'f', 4, 64),
+			strconv.FormatInt(r.MedianSolveTime.Milliseconds(), 10),
+			strconv.FormatInt(r.MeanSolveTime.Milliseconds(), 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ServeHTTP отдает отчет для административного интерфейса:
+// JSON по умолчанию или CSV при параметре format=csv
+func (m *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.Expire()
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="captcha_metrics.csv"`)
+		m.WriteCSV(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	m.WriteJSON(w)
+}
@@ -0,0 +1,291 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Максимальная скорость движения помех в анимированном режиме (пикселей за кадр)
+const maxNoiseVelocity = 1.5
+
+// noiseDot описывает точку-помеху и ее скорость в анимированном режиме
+type noiseDot struct {
+	x, y   float64
+	vx, vy float64
+	color  color.NRGBA
+}
+
+// noiseLine описывает линию-помеху и скорости ее концов в анимированном режиме
+type noiseLine struct {
+	x1, y1, x2, y2     float64
+	vx1, vy1, vx2, vy2 float64
+	widths             [3]float64 // Толщина в начале, середине и конце (пикселей)
+	color              color.NRGBA
+}
+
+// noiseArc описывает дугу-помеху и скорость ее центра в анимированном режиме
+type noiseArc struct {
+	center       point
+	velocity     point
+	radius       float64
+	start, sweep float64 // Начальный угол и угловой размер дуги в радианах
+	widths       [3]float64
+	color        color.NRGBA
+}
+
+// noiseCurve описывает кривую Безье через полосу текста и скорости
+// ее опорных точек в анимированном режиме
+type noiseCurve struct {
+	points     [4]point
+	velocities [4]point
+	widths     [3]float64
+	color      color.NRGBA
+}
+
+// noise хранит случайные помехи, чтобы их можно было
+// одинаково (или со сдвигом) нарисовать на нескольких кадрах
+type noise struct {
+	width  int
+	height int
+	size   int // Размер точки в пикселях
+	dots   []noiseDot
+	lines  []noiseLine
+	arcs   []noiseArc
+	curves []noiseCurve
+}
+
+// newNoise генерирует случайные точки, линии, дуги и кривые для изображения.
+// Кривые строятся по расположению символов glyphs
+func (c *ImageCaptcha) newNoise(glyphs []glyph) *noise {
+	n := &noise{
+		width:  c.imageWidth,
+		height: c.imageHeight,
+		size:   max(1, c.px(1)),
+	}
+
+	// Количество точек растет с площадью, чтобы плотность не зависела от масштаба
+	dots := int(float64(c.noiseDots) * c.scale * c.scale)
+
+	// Добавляем случайные помехи - точки
+	for i := 0; i < dots; i++ {
+		n.dots = append(n.dots, noiseDot{
+			x:     float64(rand.Intn(n.width)),
+			y:     float64(rand.Intn(n.height)),
+			vx:    randomVelocity() * c.scale,
+			vy:    randomVelocity() * c.scale,
+			color: noiseColor(c.noisePalette, 255),
+		})
+	}
+
+	// Добавляем случайные линии
+	for i := 0; i < c.noiseLines; i++ {
+		n.lines = append(n.lines, noiseLine{
+			x1:     float64(rand.Intn(n.width)),
+			y1:     float64(rand.Intn(n.height)),
+			x2:     float64(rand.Intn(n.width)),
+			y2:     float64(rand.Intn(n.height)),
+			vx1:    randomVelocity() * c.scale,
+			vy1:    randomVelocity() * c.scale,
+			vx2:    randomVelocity() * c.scale,
+			vy2:    randomVelocity() * c.scale,
+			widths: c.strokeWidths(c.noiseLineWidth),
+			color:  noiseColor(c.linePalette, uint8(rand.Intn(100)+100)),
+		})
+	}
+
+	// Добавляем случайные дуги
+	for i := 0; i < c.noiseArcs; i++ {
+		n.arcs = append(n.arcs, noiseArc{
+			center:   point{float64(rand.Intn(n.width)), float64(rand.Intn(n.height))},
+			velocity: point{randomVelocity() * c.scale, randomVelocity() * c.scale},
+			radius:   float64(n.height) * (minArcRadius + rand.Float64()*(maxArcRadius-minArcRadius)),
+			start:    rand.Float64() * 2 * math.Pi,
+			sweep:    (minArcSweep + rand.Float64()*(maxArcSweep-minArcSweep)) * math.Pi,
+			widths:   c.strokeWidths(c.noiseLineWidth),
+			color:    noiseColor(c.linePalette, uint8(rand.Intn(100)+100)),
+		})
+	}
+
+	// Добавляем кривые через полосу текста
+	if len(glyphs) > 0 {
+		for i := 0; i < c.bandCurves; i++ {
+			n.curves = append(n.curves, c.newBandCurve(glyphs))
+		}
+	}
+
+	return n
+}
+
+const (
+	// Радиус дуги-помехи относительно высоты изображения
+	minArcRadius = 0.25
+	maxArcRadius = 1.0
+	// Угловой размер дуги-помехи в долях π
+	minArcSweep = 0.3
+	maxArcSweep = 1.0
+
+	// Минимальное количество символов, которые пересекает кривая
+	minCurveSpan = 3
+	// Примерная высота прописной буквы относительно размера шрифта
+	capHeightRatio = 0.7
+)
+
+// newBandCurve строит кривую Безье, которая начинается у одного символа
+// и заканчивается у другого, проходя по высоте через полосу текста
+func (c *ImageCaptcha) newBandCurve(glyphs []glyph) noiseCurve {
+	span := min(minCurveSpan, len(glyphs))
+	first := rand.Intn(len(glyphs) - span + 1)
+	last := first + span - 1 + rand.Intn(len(glyphs)-first-span+1)
+
+	start, end := glyphs[first], glyphs[last]
+	x0 := float64(start.x)
+	x3 := float64(end.x + c.charWidth)
+
+	// Символ рисуется от базовой линии, поэтому его видимая часть смещена
+	// вниз от центра области символа. Кривая отклоняется от середины
+	// прописной буквы не дальше ее половины, чтобы проходить через сами символы
+	inkOffset := float64(c.fontSize) * (0.5 - capHeightRatio/2)
+	spread := float64(c.fontSize) * capHeightRatio / 2
+	bandY := func(center int) float64 {
+		return float64(center) + inkOffset + (rand.Float64()*2-1)*spread
+	}
+	centerAt := func(x float64) int {
+		index := first + int((x-x0)/(x3-x0)*float64(last-first+1))
+		return glyphs[min(max(index, first), last)].y
+	}
+
+	curve := noiseCurve{
+		points: [4]point{
+			{x0, bandY(start.y)},
+			{x0 + (x3-x0)/3, bandY(centerAt(x0 + (x3-x0)/3))},
+			{x0 + 2*(x3-x0)/3, bandY(centerAt(x0 + 2*(x3-x0)/3))},
+			{x3, bandY(end.y)},
+		},
+	}
+	for i := range curve.velocities {
+		curve.velocities[i] = point{randomVelocity() * c.scale, randomVelocity() * c.scale}
+	}
+	curve.widths = c.strokeWidths(c.bandCurveWidth)
+
+	if c.bandTextColor {
+		curve.color = color.NRGBAModel.Convert(c.glyphColor(glyphs[rand.Intn(len(glyphs))])).(color.NRGBA)
+	} else {
+		curve.color = noiseColor(c.linePalette, uint8(rand.Intn(100)+156))
+	}
+
+	return curve
+}
+
+// strokeWidths возвращает случайную толщину штриха в начале, середине и конце:
+// от половины maxWidth до maxWidth логических пикселей.
+// Штрих переменной толщины сложнее убрать морфологическими фильтрами
+func (c *ImageCaptcha) strokeWidths(maxWidth float64) [3]float64 {
+	var widths [3]float64
+	for i := range widths {
+		widths[i] = maxWidth * (0.5 + rand.Float64()/2) * c.scale
+	}
+	return widths
+}
+
+// Количество отрезков, на которые разбиваются линии, дуги и кривые при отрисовке
+const (
+	lineSegments  = 16
+	arcSegments   = 32
+	curveSegments = 48
+)
+
+// draw рисует помехи в положении, соответствующем номеру кадра
+func (n *noise) draw(img *image.RGBA, frame int) {
+	t := float64(frame)
+
+	for _, d := range n.dots {
+		fillSquare(img, bounce(d.x+d.vx*t, n.width), bounce(d.y+d.vy*t, n.height), n.size, d.color)
+	}
+
+	for _, l := range n.lines {
+		a := point{float64(bounce(l.x1+l.vx1*t, n.width)), float64(bounce(l.y1+l.vy1*t, n.height))}
+		b := point{float64(bounce(l.x2+l.vx2*t, n.width)), float64(bounce(l.y2+l.vy2*t, n.height))}
+		strokePolyline(img, linePoints(a, b, lineSegments), taperWidths(l.widths, lineSegments+1), l.color)
+	}
+
+	for _, a := range n.arcs {
+		center := point{
+			x: float64(bounce(a.center.x+a.velocity.x*t, n.width)),
+			y: float64(bounce(a.center.y+a.velocity.y*t, n.height)),
+		}
+		strokePolyline(img, arcPoints(center, a.radius, a.start, a.sweep, arcSegments),
+			taperWidths(a.widths, arcSegments+1), a.color)
+	}
+
+	for _, cv := range n.curves {
+		var p [4]point
+		for i := range p {
+			p[i] = point{
+				x: float64(bounce(cv.points[i].x+cv.velocities[i].x*t, n.width)),
+				y: float64(bounce(cv.points[i].y+cv.velocities[i].y*t, n.height)),
+			}
+		}
+		strokePolyline(img, cubicBezier(p[0], p[1], p[2], p[3], curveSegments),
+			taperWidths(cv.widths, curveSegments+1), cv.color)
+	}
+}
+
+// fillSquare накладывает квадрат size x size с левым верхним углом в (x, y)
+func fillSquare(img *image.RGBA, x, y, size int, c color.Color) {
+	for dx := 0; dx < size; dx++ {
+		for dy := 0; dy < size; dy++ {
+			blendColor(img, x+dx, y+dy, c)
+		}
+	}
+}
+
+// noiseColor возвращает случайный цвет из палитры или, если она пуста,
+// совсем случайный цвет с заданной непрозрачностью.
+// Полупрозрачный цвет задаем без премультипликации,
+// иначе при случайных R, G, B > A цвет будет некорректным
+func noiseColor(palette []color.Color, alpha uint8) color.NRGBA {
+	if len(palette) > 0 {
+		n := color.NRGBAModel.Convert(palette[rand.Intn(len(palette))]).(color.NRGBA)
+		n.A = uint8(int(n.A) * int(alpha) / 255)
+		return n
+	}
+
+	return color.NRGBA{
+		R: uint8(rand.Intn(256)),
+		G: uint8(rand.Intn(256)),
+		B: uint8(rand.Intn(256)),
+		A: alpha,
+	}
+}
+
+// randomVelocity возвращает случайную скорость движения помехи
+func randomVelocity() float64 {
+	return (rand.Float64()*2 - 1) * maxNoiseVelocity
+}
+
+// bounce приводит координату к диапазону [0, size) с отражением от краев
+func bounce(pos float64, size int) int {
+	if size <= 1 {
+		return 0
+	}
+
+	period := float64(2 * (size - 1))
+	pos = math.Mod(pos, period)
+	if pos < 0 {
+		pos += period
+	}
+	if pos > float64(size-1) {
+		pos = period - pos
+	}
+	return int(pos)
+}
+
+// Вспомогательная функция для абсолютного значения
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,94 @@
+package captcha
+
+import (
+	"image"
+	"math"
+)
+
+// Interpolation задает метод интерполяции при преобразовании изображений
+type Interpolation int
+
+const (
+	InterpolationBilinear Interpolation = iota
+	InterpolationBicubic
+)
+
+// Цвета в этом файле представлены как [R, G, B, A] в диапазоне 0..255
+// с премультиплицированной альфой, как в image.RGBA
+
+// pixelAt возвращает цвет пикселя; за пределами изображения — прозрачный
+func pixelAt(img *image.RGBA, x, y int) [4]float64 {
+	if !image.Pt(x, y).In(img.Rect) {
+		return [4]float64{}
+	}
+	i := img.PixOffset(x, y)
+	p := img.Pix[i : i+4 : i+4]
+	return [4]float64{float64(p[0]), float64(p[1]), float64(p[2]), float64(p[3])}
+}
+
+// sampleBilinear возвращает цвет в дробной точке с билинейной интерполяцией
+func sampleBilinear(img *image.RGBA, x, y float64) [4]float64 {
+	x0 := int(math.Floor(x))
+	y0 := int(math.Floor(y))
+	tx := x - float64(x0)
+	ty := y - float64(y0)
+
+	p00 := pixelAt(img, x0, y0)
+	p10 := pixelAt(img, x0+1, y0)
+	p01 := pixelAt(img, x0, y0+1)
+	p11 := pixelAt(img, x0+1, y0+1)
+
+	var out [4]float64
+	for i := range out {
+		top := p00[i]*(1-tx) + p10[i]*tx
+		bottom := p01[i]*(1-tx) + p11[i]*tx
+		out[i] = top*(1-ty) + bottom*ty
+	}
+	return out
+}
+
+// sampleBicubic возвращает цвет в дробной точке с бикубической интерполяцией (Catmull-Rom)
+func sampleBicubic(img *image.RGBA, x, y float64) [4]float64 {
+	x0 := int(math.Floor(x))
+	y0 := int(math.Floor(y))
+	tx := x - float64(x0)
+	ty := y - float64(y0)
+
+	var wx, wy [4]float64
+	for i := 0; i < 4; i++ {
+		wx[i] = cubicWeight(tx - float64(i-1))
+		wy[i] = cubicWeight(ty - float64(i-1))
+	}
+
+	var out [4]float64
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			p := pixelAt(img, x0+i-1, y0+j-1)
+			w := wx[i] * wy[j]
+			for k := range out {
+				out[k] += p[k] * w
+			}
+		}
+	}
+
+	// Кубическое ядро дает выбросы за пределы допустимых значений:
+	// ограничиваем альфу, а цвет — альфой (премультиплицированные значения)
+	out[3] = math.Max(0, math.Min(255, out[3]))
+	for k := 0; k < 3; k++ {
+		out[k] = math.Max(0, math.Min(out[3], out[k]))
+	}
+	return out
+}
+
+// cubicWeight — ядро Catmull-Rom
+func cubicWeight(t float64) float64 {
+	t = math.Abs(t)
+	switch {
+	case t < 1:
+		return 1.5*t*t*t - 2.5*t*t + 1
+	case t < 2:
+		return -0.5*t*t*t + 2.5*t*t - 4*t + 2
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,328 @@
+package captcha
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Solver распознает текст капчи. Используется для оценки устойчивости
+// капчи к автоматическому распознаванию (см. Evaluate)
+type Solver interface {
+	Solve(img image.Image) (string, error)
+}
+
+var errNoGlyphs = errors.New("captcha: no glyphs found")
+
+// Размер нормализованного шаблона символа
+const templateSize = 16
+
+// Минимальная площадь компоненты связности относительно площади изображения.
+// Меньшие компоненты считаются точками-помехами
+const minComponentArea = 0.001
+
+// TemplateSolver — базовый распознаватель: бинаризация по Оцу,
+// сегментация на компоненты связности и сопоставление с шаблонами
+// символов, отрисованных тем же шрифтом
+type TemplateSolver struct {
+	templates []charTemplate
+}
+
+type charTemplate struct {
+	char  rune
+	image [templateSize * templateSize]float64
+}
+
+// NewTemplateSolver строит шаблоны символов алфавита.
+// Если алфавит пуст, используется алфавит RandomCode
+func NewTemplateSolver(face font.Face, alphabet string) *TemplateSolver {
+	if alphabet == "" {
+		alphabet = codeAlphabet
+	}
+
+	metrics := face.Metrics()
+	size := (metrics.Ascent + metrics.Descent).Ceil() * 2
+
+	s := &TemplateSolver{}
+	for _, ch := range alphabet {
+		img := image.NewGray(image.Rect(0, 0, size, size))
+		drawer := &font.Drawer{
+			Dst:  img,
+			Src:  image.White,
+			Face: face,
+			Dot:  fixed.P(size/4, size/4+metrics.Ascent.Ceil()),
+		}
+		drawer.DrawString(string(ch))
+
+		mask := make([]bool, size*size)
+		for i, v := range img.Pix {
+			mask[i] = v >= 128
+		}
+		bounds := maskBounds(mask, size, size)
+		if bounds.Empty() {
+			continue
+		}
+
+		s.templates = append(s.templates, charTemplate{
+			char:  ch,
+			image: normalizeMask(mask, size, bounds),
+		})
+	}
+
+	return s
+}
+
+func (s *TemplateSolver) Solve(img image.Image) (string, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Переводим в оттенки серого и бинаризуем
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	draw.Draw(gray, gray.Rect, img, bounds.Min, draw.Src)
+	threshold := otsuThreshold(gray.Pix)
+
+	// Текст занимает меньшую часть изображения, по ней определяем полярность
+	dark := 0
+	for _, v := range gray.Pix {
+		if v < threshold {
+			dark++
+		}
+	}
+	textIsDark := dark < len(gray.Pix)/2
+
+	mask := make([]bool, len(gray.Pix))
+	for i, v := range gray.Pix {
+		mask[i] = (v < threshold) == textIsDark
+	}
+
+	components := connectedComponents(mask, width, height)
+
+	// Отбрасываем помехи: мелкие компоненты и тонкие длинные линии
+	minArea := int(math.Max(4, minComponentArea*float64(width*height)))
+	var glyphs []component
+	for _, comp := range components {
+		if comp.area < minArea {
+			continue
+		}
+		w, h := comp.bounds.Dx(), comp.bounds.Dy()
+		fill := float64(comp.area) / float64(w*h)
+		if fill < 0.08 && (w > height || h > height) {
+			continue
+		}
+		glyphs = append(glyphs, comp)
+	}
+	if len(glyphs) == 0 {
+		return "", errNoGlyphs
+	}
+
+	glyphs = mergeComponents(glyphs)
+	sort.Slice(glyphs, func(i, j int) bool {
+		return glyphs[i].bounds.Min.X < glyphs[j].bounds.Min.X
+	})
+
+	result := make([]rune, 0, len(glyphs))
+	for _, g := range glyphs {
+		sample := normalizeMask(g.mask(len(mask)), width, g.bounds)
+		result = append(result, s.match(sample))
+	}
+
+	return string(result), nil
+}
+
+// match возвращает символ шаблона, наиболее похожего на образец
+func (s *TemplateSolver) match(sample [templateSize * templateSize]float64) rune {
+	best := rune('?')
+	bestDistance := math.Inf(1)
+	for _, t := range s.templates {
+		distance := 0.0
+		for i := range sample {
+			d := sample[i] - t.image[i]
+			distance += d * d
+		}
+		if distance < bestDistance {
+			best, bestDistance = t.char, distance
+		}
+	}
+	return best
+}
+
+// component — компонента связности бинарного изображения
+type component struct {
+	bounds image.Rectangle
+	area   int
+	pixels []int // Индексы пикселей в маске
+}
+
+// mask возвращает маску изображения, в которой оставлены только пиксели компоненты
+func (c component) mask(size int) []bool {
+	out := make([]bool, size)
+	for _, i := range c.pixels {
+		out[i] = true
+	}
+	return out
+}
+
+// connectedComponents выделяет 8-связные компоненты маски
+func connectedComponents(mask []bool, width, height int) []component {
+	visited := make([]bool, len(mask))
+	var components []component
+	var stack []int
+
+	for start := range mask {
+		if !mask[start] || visited[start] {
+			continue
+		}
+
+		comp := component{}
+		visited[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			x, y := i%width, i/width
+			comp.pixels = append(comp.pixels, i)
+			comp.bounds = comp.bounds.Union(image.Rect(x, y, x+1, y+1))
+
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= width || ny < 0 || ny >= height {
+						continue
+					}
+					j := ny*width + nx
+					if mask[j] && !visited[j] {
+						visited[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+		comp.area = len(comp.pixels)
+		components = append(components, comp)
+	}
+
+	return components
+}
+
+// mergeComponents объединяет компоненты, которые сильно перекрываются
+// по горизонтали (точка над "i", разорванные помехами части символа)
+func mergeComponents(components []component) []component {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(components) && !merged; i++ {
+			for j := i + 1; j < len(components); j++ {
+				a, b := components[i].bounds, components[j].bounds
+				overlap := min(a.Max.X, b.Max.X) - max(a.Min.X, b.Min.X)
+				narrower := min(a.Dx(), b.Dx())
+				if overlap*2 < narrower {
+					continue
+				}
+
+				components[i].bounds = a.Union(b)
+				components[i].area += components[j].area
+				components[i].pixels = append(components[i].pixels, components[j].pixels...)
+				components = append(components[:j], components[j+1:]...)
+				merged = true
+				break
+			}
+		}
+	}
+	return components
+}
+
+// normalizeMask масштабирует область маски до шаблона фиксированного размера
+func normalizeMask(mask []bool, width int, bounds image.Rectangle) [templateSize * templateSize]float64 {
+	var out [templateSize * templateSize]float64
+
+	// Сохраняем пропорции символа: вписываем область в квадрат
+	side := max(bounds.Dx(), bounds.Dy())
+	offsetX := bounds.Min.X - (side-bounds.Dx())/2
+	offsetY := bounds.Min.Y - (side-bounds.Dy())/2
+	step := float64(side) / templateSize
+
+	for ty := 0; ty < templateSize; ty++ {
+		for tx := 0; tx < templateSize; tx++ {
+			// Доля закрашенных пикселей в ячейке шаблона
+			x0 := offsetX + int(float64(tx)*step)
+			y0 := offsetY + int(float64(ty)*step)
+			x1 := max(offsetX+int(float64(tx+1)*step), x0+1)
+			y1 := max(offsetY+int(float64(ty+1)*step), y0+1)
+
+			filled, total := 0, 0
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					total++
+					if image.Pt(x, y).In(bounds) && mask[y*width+x] {
+						filled++
+					}
+				}
+			}
+			out[ty*templateSize+tx] = float64(filled) / float64(total)
+		}
+	}
+
+	return out
+}
+
+// maskBounds возвращает границы закрашенной области маски
+func maskBounds(mask []bool, width, height int) image.Rectangle {
+	bounds := image.Rectangle{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if mask[y*width+x] {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return bounds
+}
+
+// otsuThreshold выбирает порог бинаризации по методу Оцу
+func otsuThreshold(pixels []uint8) uint8 {
+	var histogram [256]int
+	for _, v := range pixels {
+		histogram[v]++
+	}
+
+	total := len(pixels)
+	sum := 0.0
+	for i, n := range histogram {
+		sum += float64(i * n)
+	}
+
+	var (
+		sumBackground    float64
+		weightBackground int
+		bestVariance     float64
+		threshold        uint8
+	)
+	for i, n := range histogram {
+		weightBackground += n
+		if weightBackground == 0 {
+			continue
+		}
+		weightForeground := total - weightBackground
+		if weightForeground == 0 {
+			break
+		}
+
+		sumBackground += float64(i * n)
+		meanBackground := sumBackground / float64(weightBackground)
+		meanForeground := (sum - sumBackground) / float64(weightForeground)
+
+		variance := float64(weightBackground) * float64(weightForeground) *
+			(meanBackground - meanForeground) * (meanBackground - meanForeground)
+		if variance > bestVariance {
+			bestVariance = variance
+			threshold = uint8(i + 1)
+		}
+	}
+
+	return threshold
+}
@@ -0,0 +1,162 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// point — точка на плоскости в пикселях изображения
+type point struct {
+	x, y float64
+}
+
+// cubicBezier возвращает точки кубической кривой Безье,
+// разбитой на segments отрезков
+func cubicBezier(p0, p1, p2, p3 point, segments int) []point {
+	points := make([]point, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		t := float64(i) / float64(segments)
+		u := 1 - t
+		points = append(points, point{
+			x: u*u*u*p0.x + 3*u*u*t*p1.x + 3*u*t*t*p2.x + t*t*t*p3.x,
+			y: u*u*u*p0.y + 3*u*u*t*p1.y + 3*u*t*t*p2.y + t*t*t*p3.y,
+		})
+	}
+	return points
+}
+
+// arcPoints возвращает точки дуги окружности с центром center и радиусом radius
+// от угла start на угол sweep (в радианах), разбитой на segments отрезков
+func arcPoints(center point, radius, start, sweep float64, segments int) []point {
+	points := make([]point, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		angle := start + sweep*float64(i)/float64(segments)
+		points = append(points, point{
+			x: center.x + radius*math.Cos(angle),
+			y: center.y + radius*math.Sin(angle),
+		})
+	}
+	return points
+}
+
+// linePoints возвращает точки отрезка от a до b, разбитого на segments частей.
+// Промежуточные точки нужны, чтобы толщина могла плавно меняться вдоль отрезка
+func linePoints(a, b point, segments int) []point {
+	return cubicBezier(a, a, b, b, segments)
+}
+
+// taperWidths возвращает толщину в каждой из count точек штриха,
+// плавно (по квадратичной кривой) переходящую от w[0] через w[1] к w[2]
+func taperWidths(w [3]float64, count int) []float64 {
+	widths := make([]float64, count)
+	for i := range widths {
+		t := 0.0
+		if count > 1 {
+			t = float64(i) / float64(count-1)
+		}
+		u := 1 - t
+		widths[i] = u*u*w[0] + 2*u*t*w[1] + t*t*w[2]
+	}
+	return widths
+}
+
+// strokePolyline рисует сглаженную ломаную переменной толщины:
+// widths[i] задает толщину в точке points[i].
+// Каждый отрезок растеризуется как трапеция, а стыки — как круги;
+// растеризатор ограничивает покрытие единицей, поэтому перекрытия
+// не темнеют при полупрозрачном цвете
+func strokePolyline(img *image.RGBA, points []point, widths []float64, c color.Color) {
+	if len(points) == 0 || len(widths) != len(points) {
+		return
+	}
+
+	bounds := img.Bounds()
+	r := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+
+	// Растеризатор отсчитывает координаты от левого верхнего угла изображения
+	if bounds.Min != (image.Point{}) {
+		shifted := make([]point, len(points))
+		for i, p := range points {
+			shifted[i] = point{p.x - float64(bounds.Min.X), p.y - float64(bounds.Min.Y)}
+		}
+		points = shifted
+	}
+
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		dx, dy := b.x-a.x, b.y-a.y
+		length := math.Hypot(dx, dy)
+		if length == 0 {
+			continue
+		}
+
+		// Нормали к отрезку в его концах. Обход должен совпадать с обходом
+		// кругов в addCircle: растеризатор складывает площади со знаком,
+		// и встречные контуры взаимно вычитаются
+		nx, ny := -dy/length, dx/length
+		ha, hb := widths[i-1]/2, widths[i]/2
+		r.MoveTo(float32(a.x-nx*ha), float32(a.y-ny*ha))
+		r.LineTo(float32(b.x-nx*hb), float32(b.y-ny*hb))
+		r.LineTo(float32(b.x+nx*hb), float32(b.y+ny*hb))
+		r.LineTo(float32(a.x+nx*ha), float32(a.y+ny*ha))
+		r.ClosePath()
+	}
+
+	// Скругленные стыки и концы
+	for i, p := range points {
+		if widths[i] > 0 {
+			addCircle(r, p, widths[i]/2)
+		}
+	}
+
+	fillMask(img, r, c)
+}
+
+// addCircle добавляет в растеризатор круг (многоугольник) с центром p
+func addCircle(r *vector.Rasterizer, p point, radius float64) {
+	const sides = 16
+	r.MoveTo(float32(p.x+radius), float32(p.y))
+	for i := 1; i < sides; i++ {
+		angle := 2 * math.Pi * float64(i) / sides
+		r.LineTo(float32(p.x+radius*math.Cos(angle)), float32(p.y+radius*math.Sin(angle)))
+	}
+	r.ClosePath()
+}
+
+// rasterMask растеризует накопленные контуры в маску покрытия
+func rasterMask(r *vector.Rasterizer) *image.Alpha {
+	size := r.Size()
+	mask := image.NewAlpha(image.Rect(0, 0, size.X, size.Y))
+	r.Draw(mask, mask.Rect, image.Opaque, image.Point{})
+	return mask
+}
+
+// fillMask растеризует накопленные контуры и накладывает цвет по получившейся маске
+func fillMask(img *image.RGBA, r *vector.Rasterizer, c color.Color) {
+	src := premultiplied(c)
+	fillPattern(img, r, func(x, y int) [4]float64 { return src })
+}
+
+// fillPattern растеризует накопленные контуры и накладывает по маске
+// цвет, который возвращает pattern для каждого пикселя
+func fillPattern(img *image.RGBA, r *vector.Rasterizer, pattern func(x, y int) [4]float64) {
+	bounds := img.Bounds()
+	mask := rasterMask(r)
+
+	for y := 0; y < mask.Rect.Dy(); y++ {
+		for x := 0; x < mask.Rect.Dx(); x++ {
+			coverage := float64(mask.Pix[mask.PixOffset(x, y)]) / 255
+			if coverage == 0 {
+				continue
+			}
+			px, py := bounds.Min.X+x, bounds.Min.Y+y
+			src := pattern(px, py)
+			blendPixel(img, px, py, [4]float64{
+				src[0] * coverage, src[1] * coverage, src[2] * coverage, src[3] * coverage,
+			})
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Встраиваемый в SVG фон кодируем с максимальным сжатием, чтобы уменьшить размер документа
+var pngEncoder = png.Encoder{CompressionLevel: png.BestCompression}
+
+var errNoOutlineFont = errors.New("captcha: SVG output requires OutlineFont")
+
+// SVGCaptcha выводит капчу в векторном формате SVG: контуры глифов
+// берутся из шрифта и преобразуются в пути. Раскладка символов,
+// помехи и искажение те же, что и у ImageCaptcha.
+//
+// SVG слабее PNG: контуры символов передаются боту в готовом виде.
+// Контуры всех символов объединяются в один путь в случайном порядке,
+// записываются однотипными командами и перемешиваются с помехами,
+// поэтому код нельзя прочитать по структуре документа, но после
+// отрисовки документа символы распознаются так же, как в PNG,
+// только без потерь от растеризации. Используйте SVG там, где
+// важнее четкость, чем стойкость
+type SVGCaptcha struct {
+	image *ImageCaptcha
+}
+
+func NewSVGCaptcha(config ImageCaptchaConfig) (*SVGCaptcha, error) {
+	if config.OutlineFont == nil {
+		return nil, errNoOutlineFont
+	}
+	return &SVGCaptcha{image: NewImageCaptcha(config)}, nil
+}
+
+func (c *SVGCaptcha) Generate(code string) ([]byte, error) {
+	s, err := c.image.newCheckedScene(code)
+	if err != nil {
+		return nil, err
+	}
+
+	width := c.image.imageWidth
+	height := c.image.imageHeight
+
+	// Координаты внутри SVG заданы в физических пикселях,
+	// а размер документа — в логических, поэтому масштаб не влияет на отображение
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %d %d">`,
+		svgNumber(float64(width)/c.image.scale), svgNumber(float64(height)/c.image.scale), width, height)
+	switch {
+	case c.image.transparent:
+		// Фон не рисуем
+	case c.image.background != nil:
+		// Сгенерированный фон встраиваем растровым изображением
+		var encoded bytes.Buffer
+		if err := pngEncoder.Encode(&encoded, s.background); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, `<image width="%d" height="%d" href="data:image/png;base64,%s"/>`,
+			width, height, base64.StdEncoding.EncodeToString(encoded.Bytes()))
+	default:
+		fmt.Fprintf(&buf, `<rect width="%d" height="%d"%s/>`, width, height, svgPaint("fill", c.image.backgroundColor))
+	}
+
+	// Элементы выводятся в случайном порядке, символы перемешиваются
+	// с помехами, чтобы порядок элементов не выдавал код
+	var elements []string
+
+	// Контуры всех символов одного цвета объединяются в один путь
+	// в случайном порядке (см. svgContour)
+	var sbuf sfnt.Buffer
+	var colors []color.Color
+	contours := map[string][]string{} // По атрибуту цвета
+	for _, g := range s.glyphs {
+		outline, err := c.glyphOutline(&sbuf, g, s.distortion)
+		if err != nil {
+			return nil, err
+		}
+		if len(outline) == 0 {
+			continue
+		}
+		col := c.image.glyphColor(g)
+		key := svgPaint("fill", col)
+		if _, ok := contours[key]; !ok {
+			colors = append(colors, col)
+		}
+		for _, contour := range outline {
+			contours[key] = append(contours[key], svgContour(contour))
+		}
+	}
+	for _, col := range colors {
+		d := contours[svgPaint("fill", col)]
+		rand.Shuffle(len(d), func(i, j int) { d[i], d[j] = d[j], d[i] })
+		elements = append(elements, c.glyphElement(strings.Join(d, ""), col))
+	}
+
+	// Точки-помехи
+	for _, dot := range s.noise.dots {
+		x, y := s.distortion.target(dot.x, dot.y, 0)
+		elements = append(elements, fmt.Sprintf(`<rect x="%s" y="%s" width="%d" height="%d"%s/>`,
+			svgNumber(x), svgNumber(y), s.noise.size, s.noise.size, svgPaint("fill", dot.color)))
+	}
+
+	// Линии-помехи
+	for _, line := range s.noise.lines {
+		x1, y1 := s.distortion.target(line.x1, line.y1, 0)
+		x2, y2 := s.distortion.target(line.x2, line.y2, 0)
+		elements = append(elements, fmt.Sprintf(`<path d="M%s %sL%s %s" fill="none" stroke-width="%s" stroke-linecap="round"%s/>`,
+			svgNumber(x1), svgNumber(y1), svgNumber(x2), svgNumber(y2), svgStrokeWidth(line.widths), svgPaint("stroke", line.color)))
+	}
+
+	// Дуги-помехи
+	for _, arc := range s.noise.arcs {
+		ends := arcPoints(arc.center, arc.radius, arc.start, arc.sweep, 1)
+		x1, y1 := s.distortion.target(ends[0].x, ends[0].y, 0)
+		x2, y2 := s.distortion.target(ends[1].x, ends[1].y, 0)
+		largeArc := 0
+		if arc.sweep > math.Pi {
+			largeArc = 1
+		}
+		elements = append(elements, fmt.Sprintf(`<path d="M%s %sA%s %s 0 %d 1 %s %s" fill="none" stroke-width="%s" stroke-linecap="round"%s/>`,
+			svgNumber(x1), svgNumber(y1), svgNumber(arc.radius), svgNumber(arc.radius), largeArc,
+			svgNumber(x2), svgNumber(y2), svgStrokeWidth(arc.widths), svgPaint("stroke", arc.color)))
+	}
+
+	// Кривые через полосу текста. Искажаем опорные точки, а не саму кривую:
+	// при небольшой амплитуде волн результат почти не отличается
+	for _, curve := range s.noise.curves {
+		var coords [8]string
+		for i, p := range curve.points {
+			x, y := s.distortion.target(p.x, p.y, 0)
+			coords[2*i], coords[2*i+1] = svgNumber(x), svgNumber(y)
+		}
+		elements = append(elements, fmt.Sprintf(`<path d="M%s %sC%s %s %s %s %s %s" fill="none" stroke-width="%s" stroke-linecap="round"%s/>`,
+			coords[0], coords[1], coords[2], coords[3], coords[4], coords[5], coords[6], coords[7],
+			svgStrokeWidth(curve.widths), svgPaint("stroke", curve.color)))
+	}
+
+	rand.Shuffle(len(elements), func(i, j int) { elements[i], elements[j] = elements[j], elements[i] })
+	for _, e := range elements {
+		buf.WriteString(e)
+	}
+
+	buf.WriteString("</svg>")
+
+	return buf.Bytes(), nil
+}
+
+// glyphElement возвращает элемент пути символов d цвета col в стиле GlyphStyle.
+// Текстуру SVG-вывод не поддерживает: такие символы заливаются цветом
+func (c *SVGCaptcha) glyphElement(d string, col color.Color) string {
+	img := c.image
+	fill := svgPaint("fill", col)
+
+	switch img.glyphStyle {
+	case GlyphOutline:
+		return fmt.Sprintf(`<path d="%s" fill="none" stroke-width="%s" stroke-linejoin="round"%s/>`,
+			d, svgNumber(img.outlineWidth), svgPaint("stroke", col))
+	case GlyphOutlineFill:
+		return fmt.Sprintf(`<path d="%s"%s stroke-width="%s" stroke-linejoin="round"%s/>`,
+			d, fill, svgNumber(img.outlineWidth), svgPaint("stroke", img.outlineColor))
+	case GlyphShadow:
+		// Тень смещаем после искажения, поэтому у всех символов она падает в одну сторону
+		offset := svgNumber(img.shadowOffset)
+		return fmt.Sprintf(`<path d="%s" transform="translate(%s %s)"%s/><path d="%s"%s/>`,
+			d, offset, offset, svgPaint("fill", img.shadowColor), d, fill)
+	default:
+		return fmt.Sprintf(`<path d="%s"%s/>`, d, fill)
+	}
+}
+
+// cubic — сегмент контура: кубическая кривая Безье от [0] до [3]
+type cubic [4]point
+
+// glyphOutline возвращает замкнутые контуры символа в координатах
+// изображения с учетом поворота, смещения и искажения.
+// Отрезки и квадратичные кривые записываются кубическими кривыми
+func (c *SVGCaptcha) glyphOutline(sbuf *sfnt.Buffer, g glyph, dist *distortion) ([][]cubic, error) {
+	f := c.image.outlineFont
+
+	index, err := f.GlyphIndex(sbuf, g.char)
+	if err != nil {
+		return nil, err
+	}
+	if index == 0 {
+		// Символа нет в шрифте
+		return nil, nil
+	}
+
+	segments, err := f.LoadGlyph(sbuf, index, fixed.I(c.image.fontSize), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	at := func(p fixed.Point26_6) point {
+		x, y := c.glyphPoint(g, dist, p)
+		return point{x, y}
+	}
+	line := func(a, b point) cubic {
+		return cubic{a, {a.x + (b.x-a.x)/3, a.y + (b.y-a.y)/3}, {a.x + 2*(b.x-a.x)/3, a.y + 2*(b.y-a.y)/3}, b}
+	}
+
+	var contours [][]cubic
+	var contour []cubic
+	var start, current point
+	closeContour := func() {
+		if len(contour) == 0 {
+			return
+		}
+		if current != start {
+			contour = append(contour, line(current, start))
+		}
+		contours = append(contours, contour)
+		contour = nil
+	}
+
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			closeContour()
+			start = at(seg.Args[0])
+			current = start
+		case sfnt.SegmentOpLineTo:
+			p := at(seg.Args[0])
+			contour = append(contour, line(current, p))
+			current = p
+		case sfnt.SegmentOpQuadTo:
+			p1, p2 := at(seg.Args[0]), at(seg.Args[1])
+			c1 := point{current.x + 2*(p1.x-current.x)/3, current.y + 2*(p1.y-current.y)/3}
+			c2 := point{p2.x + 2*(p1.x-p2.x)/3, p2.y + 2*(p1.y-p2.y)/3}
+			contour = append(contour, cubic{current, c1, c2, p2})
+			current = p2
+		case sfnt.SegmentOpCubeTo:
+			p := at(seg.Args[2])
+			contour = append(contour, cubic{current, at(seg.Args[0]), at(seg.Args[1]), p})
+			current = p
+		}
+	}
+	closeContour()
+
+	return contours, nil
+}
+
+// Доля сегментов контура, которые svgContour делит пополам
+const svgSplitChance = 0.3
+
+// svgContour записывает контур в данные SVG-пути так, чтобы по командам
+// нельзя было узнать символ: все сегменты — кривые "C", контур начинается
+// со случайного сегмента, а часть сегментов делится пополам
+func svgContour(contour []cubic) string {
+	shift := rand.Intn(len(contour))
+
+	var d strings.Builder
+	fmt.Fprintf(&d, "M%s %s", svgNumber(contour[shift][0].x), svgNumber(contour[shift][0].y))
+	for i := range contour {
+		seg := contour[(shift+i)%len(contour)]
+		parts := []cubic{seg}
+		if rand.Float64() < svgSplitChance {
+			parts = splitCubic(seg)
+		}
+		for _, p := range parts {
+			fmt.Fprintf(&d, "C%s %s %s %s %s %s",
+				svgNumber(p[1].x), svgNumber(p[1].y), svgNumber(p[2].x), svgNumber(p[2].y),
+				svgNumber(p[3].x), svgNumber(p[3].y))
+		}
+	}
+	d.WriteByte('Z')
+	return d.String()
+}
+
+// splitCubic делит кривую пополам по алгоритму де Кастельжо
+func splitCubic(c cubic) []cubic {
+	mid := func(a, b point) point { return point{(a.x + b.x) / 2, (a.y + b.y) / 2} }
+	ab, bc, cd := mid(c[0], c[1]), mid(c[1], c[2]), mid(c[2], c[3])
+	abc, bcd := mid(ab, bc), mid(bc, cd)
+	m := mid(abc, bcd)
+	return []cubic{{c[0], ab, abc, m}, {m, bcd, cd, c[3]}}
+}
+
+// glyphPoint переводит точку контура в координаты изображения так же,
+// как drawGlyph переносит пиксели символа
+func (c *SVGCaptcha) glyphPoint(g glyph, d *distortion, p fixed.Point26_6) (float64, float64) {
+	// Координаты в области символа: начало строки как у font.Drawer в drawGlyph
+	originX, originY := c.image.glyphOrigin()
+	localX := float64(originX) + float64(p.X)/64
+	localY := float64(originY) + float64(p.Y)/64
+
+	// Координаты относительно центра символа
+	relX := localX - float64(c.image.charWidth/2)
+	relY := localY - float64(c.image.charHeight/2)
+
+	// Применяем масштаб и наклон: верх символа (отрицательные y) уходит вправо
+	size := g.sizeOrDefault()
+	relX, relY = (relX-g.shear*relY)*size, relY*size
+
+	// Применяем вращение
+	rotX := relX*math.Cos(g.angle) - relY*math.Sin(g.angle)
+	rotY := relX*math.Sin(g.angle) + relY*math.Cos(g.angle)
+
+	x := rotX + float64(g.x+c.image.charWidth/2)
+	y := rotY + float64(g.y)
+
+	return d.target(x, y, 0)
+}
+
+// svgPaint возвращает атрибуты цвета и прозрачности для SVG
+func svgPaint(attr string, c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	paint := fmt.Sprintf(` %s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	if n.A != 255 {
+		paint += fmt.Sprintf(` %s-opacity="%s"`, attr, svgNumber(float64(n.A)/255))
+	}
+	return paint
+}
+
+// svgStrokeWidth возвращает толщину штриха для SVG. SVG не поддерживает
+// переменную толщину, поэтому берем среднюю
+func svgStrokeWidth(widths [3]float64) string {
+	return svgNumber((widths[0] + widths[1] + widths[2]) / 3)
+}
+
+// svgNumber форматирует число с точностью до сотых без лишних нулей
+func svgNumber(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	for s[len(s)-1] == '0' {
+		s = s[:len(s)-1]
+	}
+	if s[len(s)-1] == '.' {
+		s = s[:len(s)-1]
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+var _ Captcha = (*SVGCaptcha)(nil)
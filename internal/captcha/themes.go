@@ -0,0 +1,120 @@
+package captcha
+
+import (
+	"image/color"
+	"sort"
+)
+
+// Theme — согласованный набор цветов фона, текста и помех
+type Theme struct {
+	Name       string
+	Background color.Color
+	Text       color.Color
+	Noise      []color.Color // Палитра точек-помех
+	Lines      []color.Color // Палитра линий-помех
+}
+
+// Apply возвращает копию конфигурации с цветами темы.
+// Случайные цвета символов (GlyphColors) отключаются, чтобы не нарушить тему
+func (t Theme) Apply(config ImageCaptchaConfig) ImageCaptchaConfig {
+	config.BackgroundColor = t.Background
+	config.TextColor = t.Text
+	config.NoisePalette = t.Noise
+	config.LinePalette = t.Lines
+	config.GlyphColors = nil
+	return config
+}
+
+var (
+	// ThemeDefault — темный текст на белом фоне со светлыми помехами
+	ThemeDefault = Theme{
+		Name:       "default",
+		Background: color.White,
+		Text:       color.RGBA{R: 26, G: 26, B: 26, A: 255},
+		Noise: []color.Color{
+			color.RGBA{R: 158, G: 202, B: 225, A: 255},
+			color.RGBA{R: 253, G: 174, B: 107, A: 255},
+			color.RGBA{R: 161, G: 217, B: 155, A: 255},
+			color.RGBA{R: 188, G: 189, B: 220, A: 255},
+		},
+		Lines: []color.Color{
+			color.RGBA{R: 107, G: 174, B: 214, A: 255},
+			color.RGBA{R: 253, G: 141, B: 60, A: 255},
+			color.RGBA{R: 116, G: 196, B: 118, A: 255},
+		},
+	}
+
+	// ThemeDark — светлый текст на темном фоне для темного режима интерфейса
+	ThemeDark = Theme{
+		Name:       "dark",
+		Background: color.RGBA{R: 30, G: 30, B: 30, A: 255},
+		Text:       color.RGBA{R: 255, G: 224, B: 102, A: 255},
+		Noise: []color.Color{
+			color.RGBA{R: 60, G: 90, B: 120, A: 255},
+			color.RGBA{R: 90, G: 60, B: 120, A: 255},
+			color.RGBA{R: 60, G: 110, B: 80, A: 255},
+		},
+		Lines: []color.Color{
+			color.RGBA{R: 74, G: 111, B: 165, A: 255},
+			color.RGBA{R: 140, G: 70, B: 100, A: 255},
+		},
+	}
+
+	// ThemeHighContrast — белый текст на черном фоне с приглушенными серыми помехами
+	ThemeHighContrast = Theme{
+		Name:       "high-contrast",
+		Background: color.Black,
+		Text:       color.White,
+		Noise: []color.Color{
+			color.RGBA{R: 64, G: 64, B: 64, A: 255},
+			color.RGBA{R: 80, G: 80, B: 80, A: 255},
+		},
+		Lines: []color.Color{
+			color.RGBA{R: 96, G: 96, B: 96, A: 255},
+		},
+	}
+
+	// ThemeColorblindSafe — безопасная для дейтеранопии и протанопии тема:
+	// различие текста и помех держится на яркости и оси синий-оранжевый,
+	// которая сохраняется при нарушениях красно-зеленого восприятия
+	ThemeColorblindSafe = Theme{
+		Name:       "colorblind-safe",
+		Background: color.RGBA{R: 255, G: 250, B: 240, A: 255},
+		Text:       color.RGBA{R: 8, G: 48, B: 107, A: 255},
+		Noise: []color.Color{
+			color.RGBA{R: 253, G: 212, B: 158, A: 255},
+			color.RGBA{R: 253, G: 187, B: 132, A: 255},
+			color.RGBA{R: 198, G: 219, B: 239, A: 255},
+		},
+		Lines: []color.Color{
+			color.RGBA{R: 230, G: 159, B: 0, A: 255},
+			color.RGBA{R: 240, G: 228, B: 66, A: 255},
+		},
+	}
+)
+
+var themes = map[string]Theme{
+	ThemeDefault.Name:        ThemeDefault,
+	ThemeDark.Name:           ThemeDark,
+	ThemeHighContrast.Name:   ThemeHighContrast,
+	ThemeColorblindSafe.Name: ThemeColorblindSafe,
+	// Одна тема подходит для обоих нарушений красно-зеленого восприятия
+	"deuteranopia": ThemeColorblindSafe,
+	"protanopia":   ThemeColorblindSafe,
+}
+
+// ThemeByName возвращает тему по названию
+func ThemeByName(name string) (Theme, bool) {
+	t, ok := themes[name]
+	return t, ok
+}
+
+// ThemeNames возвращает названия всех тем, включая псевдонимы
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
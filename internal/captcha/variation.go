@@ -0,0 +1,55 @@
+package captcha
+
+import (
+	"math"
+	"math/rand"
+)
+
+// randomShape возвращает случайные масштаб и наклон символа в заданных диапазонах
+func (c *ImageCaptcha) randomShape() (size, shear float64) {
+	size = c.charScaleMin + rand.Float64()*(c.charScaleMax-c.charScaleMin)
+	shear = c.shearMin + rand.Float64()*(c.shearMax-c.shearMin)
+	return size, shear
+}
+
+// maxShear возвращает наибольший по модулю наклон символа
+func (c *ImageCaptcha) maxShear() float64 {
+	return math.Max(math.Abs(c.shearMin), math.Abs(c.shearMax))
+}
+
+// shearGap возвращает дополнительный интервал между символами с наклонами a и b:
+// наклоненные в разные стороны символы сближаются верхом или низом
+// на половину высоты прописной буквы, умноженную на наклон
+func (c *ImageCaptcha) shearGap(a, b float64) int {
+	return int(math.Ceil((math.Abs(a) + math.Abs(b)) / 2 * capHeightRatio * float64(c.fontSize) / 2))
+}
+
+// maxBaselineCurve возвращает наибольший по модулю прогиб базовой линии в пикселях
+func (c *ImageCaptcha) maxBaselineCurve() float64 {
+	return math.Max(math.Abs(c.curveMin), math.Abs(c.curveMax)) * c.scale
+}
+
+// bendBaseline располагает символы вдоль параболы со случайным прогибом
+// и поворачивает каждый символ по касательной к ней. Середина текста
+// сдвигается на половину прогиба в одну сторону, края — в другую,
+// поэтому по высоте текст остается в пределах ±прогиб/2
+func (c *ImageCaptcha) bendBaseline(glyphs []glyph) {
+	curve := (c.curveMin + rand.Float64()*(c.curveMax-c.curveMin)) * c.scale
+	if curve == 0 || len(glyphs) < 2 {
+		return
+	}
+
+	first := float64(glyphs[0].x)
+	last := float64(glyphs[len(glyphs)-1].x)
+	mid := (first + last) / 2
+	half := (last - first) / 2
+	if half <= 0 {
+		return
+	}
+
+	for i := range glyphs {
+		t := (float64(glyphs[i].x) - mid) / half
+		glyphs[i].y += int(math.Round(curve*(1-t*t) - curve/2))
+		glyphs[i].angle += math.Atan(-2 * curve * t / half)
+	}
+}
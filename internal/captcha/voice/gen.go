@@ -0,0 +1,323 @@
+//go:build ignore
+
+// Генератор встроенного набора голосовых записей для AudioCaptcha.
+// Названия символов (английские) синтезируются простым формантным
+// синтезатором: голосовой источник и шум проходят через резонаторы,
+// частоты которых плавно переходят от фонемы к фонеме.
+//
+// Запуск из каталога internal/captcha/voice:
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+)
+
+const sampleRate = 16000
+
+// segment — участок звука с постоянными целевыми параметрами
+type segment struct {
+	dur     float64    // Длительность в секундах
+	f       [3]float64 // Частоты формант
+	bw      [3]float64 // Ширины полос формант
+	voice   float64    // Амплитуда голосового источника
+	aspir   float64    // Амплитуда придыхания (шум через форманты)
+	fric    float64    // Амплитуда фрикативного шума
+	fricF   float64    // Центральная частота фрикативного шума
+	fricBW  float64    // Ширина полосы фрикативного шума
+	instant bool       // Параметры меняются скачком, без перехода
+}
+
+var vowels = map[string][3]float64{
+	"iy": {270, 2290, 3010},
+	"ih": {390, 1990, 2550},
+	"eh": {530, 1840, 2480},
+	"ae": {660, 1720, 2410},
+	"aa": {730, 1090, 2440},
+	"ah": {600, 1170, 2390},
+	"ao": {570, 840, 2410},
+	"uw": {300, 870, 2240},
+	"ow": {500, 900, 2400},
+	"er": {490, 1350, 1690},
+	// Аппроксиманты и носовые
+	"l": {360, 1000, 2700},
+	"r": {420, 1250, 1600},
+	"w": {290, 650, 2200},
+	"y": {260, 2200, 3000},
+	"m": {270, 1000, 2200},
+	"n": {270, 1500, 2500},
+}
+
+var defaultBW = [3]float64{80, 100, 150}
+
+// Локусы второй форманты смычных: к ним стремятся переходы соседних гласных
+var stopLocus = map[string][3]float64{
+	"b": {200, 900, 2200},
+	"p": {200, 900, 2200},
+	"d": {200, 1700, 2600},
+	"t": {200, 1700, 2600},
+	"g": {200, 2200, 2700},
+	"k": {200, 2200, 2700},
+}
+
+// Частота шума взрыва смычных
+var burstFreq = map[string]float64{"b": 1200, "p": 1200, "d": 4000, "t": 4000, "g": 2500, "k": 2500}
+
+type fricative struct {
+	freq, bw, amp float64
+	voiced        bool
+}
+
+var fricatives = map[string]fricative{
+	"s":  {5500, 1500, 0.55, false},
+	"z":  {5500, 1500, 0.4, true},
+	"f":  {6000, 3000, 0.2, false},
+	"v":  {6000, 3000, 0.12, true},
+	"th": {6500, 4000, 0.15, false},
+	"sh": {3000, 1200, 0.55, false},
+	"zh": {3000, 1200, 0.4, true},
+}
+
+// Названия символов в виде фонем. Гласная с суффиксом ":" — ударная (длиннее)
+var names = map[string][]string{
+	"A": {"eh:", "iy"},
+	"B": {"b", "iy:"},
+	"C": {"s", "iy:"},
+	"D": {"d", "iy:"},
+	"E": {"iy:"},
+	"F": {"eh:", "f"},
+	"G": {"d", "zh", "iy:"},
+	"H": {"eh:", "iy", "t", "sh"},
+	"I": {"aa:", "iy"},
+	"J": {"d", "zh", "eh:", "iy"},
+	"K": {"k", "eh:", "iy"},
+	"L": {"eh:", "l"},
+	"M": {"eh:", "m"},
+	"N": {"eh:", "n"},
+	"O": {"ow:", "uw"},
+	"P": {"p", "iy:"},
+	"Q": {"k", "y", "uw:"},
+	"R": {"aa:", "r"},
+	"S": {"eh:", "s"},
+	"T": {"t", "iy:"},
+	"U": {"y", "uw:"},
+	"V": {"v", "iy:"},
+	"W": {"d", "ah:", "b", "ah", "l", "y", "uw"},
+	"X": {"eh:", "k", "s"},
+	"Y": {"w", "aa:", "iy"},
+	"Z": {"z", "iy:"},
+	"0": {"z", "iy:", "r", "ow", "uw"},
+	"1": {"w", "ah:", "n"},
+	"2": {"t", "uw:"},
+	"3": {"th", "r", "iy:"},
+	"4": {"f", "ao:", "r"},
+	"5": {"f", "aa:", "iy", "v"},
+	"6": {"s", "ih:", "k", "s"},
+	"7": {"s", "eh:", "v", "ah", "n"},
+	"8": {"eh:", "iy", "t"},
+	"9": {"n", "aa:", "iy", "n"},
+}
+
+func main() {
+	rand.Seed(1)
+	for name, phonemes := range names {
+		samples := synthesize(phonemes)
+		if err := os.WriteFile(name+".wav", encode8(samples), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// segments переводит фонемы в последовательность участков
+func segments(phonemes []string) []segment {
+	var out []segment
+	next := func(i int) [3]float64 {
+		for j := i + 1; j < len(phonemes); j++ {
+			if f, ok := vowels[trim(phonemes[j])]; ok {
+				return f
+			}
+		}
+		return vowels["ah"]
+	}
+
+	for i, p := range phonemes {
+		stressed := len(p) > 0 && p[len(p)-1] == ':'
+		p = trim(p)
+
+		if f, ok := vowels[p]; ok {
+			dur, amp := 0.12, 1.0
+			switch {
+			case stressed:
+				dur = 0.22
+			case p == "l" || p == "r" || p == "w" || p == "y":
+				dur, amp = 0.08, 0.7
+			case p == "m" || p == "n":
+				dur, amp = 0.1, 0.35
+			}
+			if i == len(phonemes)-1 {
+				dur += 0.06
+			}
+			out = append(out, segment{dur: dur, f: f, bw: defaultBW, voice: amp})
+			continue
+		}
+
+		if locus, ok := stopLocus[p]; ok {
+			voiced := p == "b" || p == "d" || p == "g"
+			closure := segment{dur: 0.06, f: locus, bw: defaultBW, instant: true}
+			if voiced {
+				closure.voice = 0.08
+			}
+			out = append(out, closure)
+			out = append(out, segment{dur: 0.012, f: locus, bw: defaultBW, fric: 0.6, fricF: burstFreq[p], fricBW: 2000, instant: true})
+			if !voiced && i < len(phonemes)-1 {
+				out = append(out, segment{dur: 0.05, f: next(i), bw: [3]float64{200, 200, 250}, aspir: 0.35})
+			}
+			continue
+		}
+
+		fr := fricatives[p]
+		dur := 0.11
+		if i == len(phonemes)-1 {
+			dur = 0.15
+		}
+		s := segment{dur: dur, f: next(i), bw: defaultBW, fric: fr.amp, fricF: fr.freq, fricBW: fr.bw}
+		if fr.voiced {
+			s.voice = 0.25
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func trim(p string) string {
+	if len(p) > 0 && p[len(p)-1] == ':' {
+		return p[:len(p)-1]
+	}
+	return p
+}
+
+// resonator — двухполюсный резонатор с меняющимися параметрами
+type resonator struct{ y1, y2 float64 }
+
+func (r *resonator) step(x, freq, bw float64) float64 {
+	t := 1.0 / sampleRate
+	c := -math.Exp(-2 * math.Pi * bw * t)
+	b := 2 * math.Exp(-math.Pi*bw*t) * math.Cos(2*math.Pi*freq*t)
+	a := 1 - b - c
+	y := a*x + b*r.y1 + c*r.y2
+	r.y2, r.y1 = r.y1, y
+	return y
+}
+
+func synthesize(phonemes []string) []float64 {
+	segs := segments(phonemes)
+	total := 0.0
+	for _, s := range segs {
+		total += s.dur
+	}
+	n := int(total * sampleRate)
+	out := make([]float64, 0, n)
+
+	var cascade [3]resonator
+	var fricRes resonator
+	prev := segs[0]
+	phase, lastGlottal := 0.0, 0.0
+	elapsed := 0.0
+	const transition = 0.04
+
+	for _, s := range segs {
+		count := int(s.dur * sampleRate)
+		for i := 0; i < count; i++ {
+			t := float64(i) / sampleRate
+			k := 1.0
+			if !s.instant && t < transition {
+				k = t / transition
+			}
+			mix := func(a, b float64) float64 { return a + (b-a)*k }
+
+			// Голосовой источник: импульс Розенберга с понижающимся тоном
+			progress := (elapsed + t) / total
+			f0 := 135 - 35*progress
+			phase += f0 / sampleRate
+			phase -= math.Floor(phase)
+			g := 0.0
+			switch {
+			case phase < 0.4:
+				g = 0.5 * (1 - math.Cos(math.Pi*phase/0.4))
+			case phase < 0.6:
+				g = math.Cos(math.Pi * (phase - 0.4) / 0.4)
+			}
+			glottal := g - lastGlottal // Излучение губами — производная
+			lastGlottal = g
+
+			noise := rand.Float64()*2 - 1
+			x := mix(prev.voice, s.voice)*glottal*8 + mix(prev.aspir, s.aspir)*noise*0.3
+			for j := range cascade {
+				x = cascade[j].step(x, mix(prev.f[j], s.f[j]), mix(prev.bw[j], s.bw[j]))
+			}
+
+			fric := 0.0
+			if amp := mix(prev.fric, s.fric); amp > 0 {
+				freq, bw := s.fricF, s.fricBW
+				if freq == 0 {
+					freq, bw = prev.fricF, prev.fricBW
+				}
+				fric = fricRes.step(noise*amp, freq, bw)
+			}
+			out = append(out, x+fric*0.2)
+		}
+		elapsed += s.dur
+		prev = s
+	}
+
+	// Плавные края и нормировка
+	fade := int(0.01 * sampleRate)
+	peak := 0.0
+	for i, v := range out {
+		if i < fade {
+			out[i] = v * float64(i) / float64(fade)
+		}
+		if j := len(out) - 1 - i; j < fade {
+			out[i] = out[i] * float64(j) / float64(fade)
+		}
+		peak = math.Max(peak, math.Abs(out[i]))
+	}
+	for i := range out {
+		out[i] *= 0.9 / peak
+	}
+	return out
+}
+
+// encode8 кодирует сэмплы в 8-битный моно PCM WAV
+func encode8(samples []float64) []byte {
+	// Чанк данных нечетной длины дополняется байтом до четной границы
+	pad := len(samples) % 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(samples)+pad))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(8))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(samples)))
+	for _, s := range samples {
+		buf.WriteByte(byte(math.Round(128 + math.Max(-1, math.Min(1, s))*127)))
+	}
+	if pad == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
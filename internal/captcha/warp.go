@@ -0,0 +1,310 @@
+package captcha
+
+import (
+	"image"
+	"math"
+	"math/rand"
+)
+
+// Distortion задает дополнительную стадию искажения изображения
+type Distortion int
+
+const (
+	// Упругое искажение: случайное плавное поле смещений
+	DistortionElastic Distortion = iota + 1
+	// Перспективное (проективное) искажение блока текста
+	DistortionPerspective
+	// Закручивание вокруг случайной точки
+	DistortionSwirl
+	// Линза "рыбий глаз": увеличение или сжатие вокруг случайной точки
+	DistortionFisheye
+)
+
+func (d Distortion) String() string {
+	switch d {
+	case DistortionElastic:
+		return "elastic"
+	case DistortionPerspective:
+		return "perspective"
+	case DistortionSwirl:
+		return "swirl"
+	case DistortionFisheye:
+		return "fisheye"
+	default:
+		return "unknown"
+	}
+}
+
+// warp — стадия искажения, заданная обратным отображением
+type warp interface {
+	// source возвращает точку исходного изображения, из которой
+	// берется пиксель (x, y) искаженного изображения
+	source(x, y float64) (float64, float64)
+}
+
+// Параметры стадий искажения. Размеры заданы в логических пикселях,
+// амплитуды дополнительно умножаются на DistortionScale
+const (
+	elasticCell      = 16.0 // Шаг сетки поля смещений
+	elasticAmplitude = 2.5  // Наибольшее смещение узла сетки
+
+	perspectiveScale = 0.08 // Наибольшее отклонение масштаба от 1
+	perspectiveShear = 0.15 // Наибольший сдвиг (наклон)
+	perspectiveDepth = 0.12 // Наибольший перспективный коэффициент
+
+	swirlAngle = 0.6 // Наибольший угол закручивания в центре (радиан)
+
+	fisheyeStrength = 0.3 // Наибольшее увеличение (или сжатие) в центре линзы
+)
+
+// newWarps создает стадии искажения в порядке, заданном Distortions.
+// Параметры каждой стадии выбираются генератором со своим случайным зерном,
+// поэтому стадия не зависит от того, сколько случайных чисел потребовали другие.
+// Стадии настраиваются по области, которую занимают символы glyphs
+func (c *ImageCaptcha) newWarps(glyphs []glyph) []warp {
+	if len(c.distortions) == 0 || len(glyphs) == 0 {
+		return nil
+	}
+
+	block := c.textBlock(glyphs)
+	warps := make([]warp, 0, len(c.distortions))
+	for _, d := range c.distortions {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		switch d {
+		case DistortionElastic:
+			warps = append(warps, c.newElasticWarp(r))
+		case DistortionPerspective:
+			warps = append(warps, c.newPerspectiveWarp(r, block))
+		case DistortionSwirl:
+			warps = append(warps, c.newSwirlWarp(r, block))
+		case DistortionFisheye:
+			warps = append(warps, c.newFisheyeWarp(r, block))
+		}
+	}
+	return warps
+}
+
+// textBlock возвращает прямоугольник, в котором расположены символы
+func (c *ImageCaptcha) textBlock(glyphs []glyph) image.Rectangle {
+	var block image.Rectangle
+	for _, g := range glyphs {
+		block = block.Union(image.Rect(g.x, g.y-c.charHeight/2, g.x+c.charWidth, g.y+c.charHeight/2))
+	}
+	return block
+}
+
+// warpSource переводит точку искаженного изображения в точку исходного.
+// Стадии применяются к изображению по порядку, поэтому обратные
+// отображения вызываются в обратном порядке
+func warpSource(warps []warp, x, y float64) (float64, float64) {
+	for i := len(warps) - 1; i >= 0; i-- {
+		x, y = warps[i].source(x, y)
+	}
+	return x, y
+}
+
+// Количество итераций при обращении искажения
+const warpInverseIterations = 20
+
+// warpTarget переводит точку исходного изображения в точку искаженного.
+// Обратное отображение обращаем методом Ньютона с численным якобианом:
+// искажения плавные, поэтому достаточно нескольких итераций
+func warpTarget(warps []warp, x, y float64) (float64, float64) {
+	if len(warps) == 0 {
+		return x, y
+	}
+
+	const h = 0.5 // Шаг численного дифференцирования в пикселях
+
+	px, py := x, y
+	for i := 0; i < warpInverseIterations; i++ {
+		sx, sy := warpSource(warps, px, py)
+		ex, ey := sx-x, sy-y
+		if math.Abs(ex) < 1e-3 && math.Abs(ey) < 1e-3 {
+			break
+		}
+
+		ax, ay := warpSource(warps, px+h, py)
+		bx, by := warpSource(warps, px, py+h)
+		j00, j10 := (ax-sx)/h, (ay-sy)/h
+		j01, j11 := (bx-sx)/h, (by-sy)/h
+
+		det := j00*j11 - j01*j10
+		if math.Abs(det) < 1e-9 {
+			// Вырожденный якобиан: делаем простой шаг
+			px -= ex
+			py -= ey
+			continue
+		}
+		px -= (j11*ex - j01*ey) / det
+		py -= (j00*ey - j10*ex) / det
+	}
+	return px, py
+}
+
+// elasticWarp — упругое искажение: смещения задаются в узлах грубой сетки
+// и плавно интерполируются между ними
+type elasticWarp struct {
+	cell       float64
+	cols, rows int
+	dx, dy     []float64
+}
+
+func (c *ImageCaptcha) newElasticWarp(r *rand.Rand) *elasticWarp {
+	cell := elasticCell * c.scale
+	amplitude := elasticAmplitude * c.distortionScale * c.scale
+
+	w := &elasticWarp{
+		cell: cell,
+		cols: int(math.Ceil(float64(c.imageWidth)/cell)) + 1,
+		rows: int(math.Ceil(float64(c.imageHeight)/cell)) + 1,
+	}
+	w.dx = make([]float64, w.cols*w.rows)
+	w.dy = make([]float64, w.cols*w.rows)
+	for i := range w.dx {
+		w.dx[i] = (r.Float64()*2 - 1) * amplitude
+		w.dy[i] = (r.Float64()*2 - 1) * amplitude
+	}
+	return w
+}
+
+func (w *elasticWarp) source(x, y float64) (float64, float64) {
+	gx := math.Max(0, math.Min(x/w.cell, float64(w.cols-1)))
+	gy := math.Max(0, math.Min(y/w.cell, float64(w.rows-1)))
+	col := min(int(gx), w.cols-2)
+	row := min(int(gy), w.rows-2)
+
+	// Сглаженная интерполяция, чтобы на границах ячеек не было изломов
+	tx := fade(gx - float64(col))
+	ty := fade(gy - float64(row))
+
+	at := func(values []float64) float64 {
+		i := row*w.cols + col
+		top := lerp(values[i], values[i+1], tx)
+		bottom := lerp(values[i+w.cols], values[i+w.cols+1], tx)
+		return lerp(top, bottom, ty)
+	}
+	return x + at(w.dx), y + at(w.dy)
+}
+
+// perspectiveWarp — проективное преобразование в координатах,
+// нормированных по блоку текста: масштаб, наклон и перспектива
+type perspectiveWarp struct {
+	cx, cy float64 // Центр блока текста
+	sx, sy float64 // Половины размеров блока для нормировки
+	m      [8]float64
+}
+
+func (c *ImageCaptcha) newPerspectiveWarp(r *rand.Rand, block image.Rectangle) *perspectiveWarp {
+	ds := c.distortionScale
+	uniform := func(limit float64) float64 {
+		return (r.Float64()*2 - 1) * limit * ds
+	}
+
+	return &perspectiveWarp{
+		cx: float64(block.Min.X+block.Max.X) / 2,
+		cy: float64(block.Min.Y+block.Max.Y) / 2,
+		sx: math.Max(1, float64(block.Dx())/2),
+		sy: math.Max(1, float64(block.Dy())/2),
+		// u' = (m0*u + m1*v + m2) / (m6*u + m7*v + 1), v' = (m3*u + m4*v + m5) / (...)
+		m: [8]float64{
+			1 + uniform(perspectiveScale), uniform(perspectiveShear), 0,
+			uniform(perspectiveShear / 2), 1 + uniform(perspectiveScale), 0,
+			uniform(perspectiveDepth), uniform(perspectiveDepth),
+		},
+	}
+}
+
+func (w *perspectiveWarp) source(x, y float64) (float64, float64) {
+	u := (x - w.cx) / w.sx
+	v := (y - w.cy) / w.sy
+	m := w.m
+
+	d := m[6]*u + m[7]*v + 1
+	if d <= 0 {
+		// Точка за горизонтом: берем ее из-за пределов изображения
+		return -1, -1
+	}
+	su := (m[0]*u + m[1]*v + m[2]) / d
+	sv := (m[3]*u + m[4]*v + m[5]) / d
+	return w.cx + su*w.sx, w.cy + sv*w.sy
+}
+
+// swirlWarp закручивает изображение вокруг центра: угол поворота
+// наибольший в центре и плавно убывает до нуля на радиусе
+type swirlWarp struct {
+	cx, cy float64
+	radius float64
+	angle  float64
+}
+
+func (c *ImageCaptcha) newSwirlWarp(r *rand.Rand, block image.Rectangle) *swirlWarp {
+	cx, cy := randomCenter(r, block)
+	angle := (0.5 + r.Float64()/2) * swirlAngle * c.distortionScale
+	if r.Intn(2) == 0 {
+		angle = -angle
+	}
+
+	return &swirlWarp{
+		cx:     cx,
+		cy:     cy,
+		radius: (0.4 + 0.4*r.Float64()) * float64(max(block.Dx(), block.Dy())),
+		angle:  angle,
+	}
+}
+
+func (w *swirlWarp) source(x, y float64) (float64, float64) {
+	dx, dy := x-w.cx, y-w.cy
+	dist := math.Hypot(dx, dy)
+	if dist >= w.radius {
+		return x, y
+	}
+
+	t := 1 - dist/w.radius
+	sin, cos := math.Sincos(w.angle * t * t)
+	return w.cx + dx*cos - dy*sin, w.cy + dx*sin + dy*cos
+}
+
+// fisheyeWarp — линза: внутри радиуса изображение увеличивается
+// (при положительной силе) или сжимается (при отрицательной)
+type fisheyeWarp struct {
+	cx, cy   float64
+	radius   float64
+	strength float64
+}
+
+func (c *ImageCaptcha) newFisheyeWarp(r *rand.Rand, block image.Rectangle) *fisheyeWarp {
+	cx, cy := randomCenter(r, block)
+	// Сила меньше 1 по модулю, иначе центр линзы вырождается в точку
+	strength := math.Min(0.9, (0.5+r.Float64()/2)*fisheyeStrength*c.distortionScale)
+	if r.Intn(2) == 0 {
+		strength = -strength
+	}
+
+	return &fisheyeWarp{
+		cx:       cx,
+		cy:       cy,
+		radius:   (0.5 + 0.5*r.Float64()) * float64(block.Dy()),
+		strength: strength,
+	}
+}
+
+func (w *fisheyeWarp) source(x, y float64) (float64, float64) {
+	dx, dy := x-w.cx, y-w.cy
+	dist := math.Hypot(dx, dy)
+	if dist >= w.radius {
+		return x, y
+	}
+
+	// Масштаб 1-strength в центре плавно переходит в 1 на границе линзы
+	t := 1 - dist/w.radius
+	k := 1 - w.strength*t*t
+	return w.cx + dx*k, w.cy + dy*k
+}
+
+// randomCenter возвращает случайную точку в средней половине блока
+func randomCenter(r *rand.Rand, block image.Rectangle) (float64, float64) {
+	x := float64(block.Min.X) + float64(block.Dx())*(0.25+0.5*r.Float64())
+	y := float64(block.Min.Y) + float64(block.Dy())*(0.25+0.5*r.Float64())
+	return x, y
+}
@@ -0,0 +1,135 @@
+package captcha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errInvalidWAV = errors.New("captcha: invalid WAV data")
+
+// decodeWAV читает PCM WAV (8 или 16 бит, моно или стерео)
+// и возвращает моно-сэмплы в диапазоне [-1, 1] и частоту дискретизации
+func decodeWAV(data []byte) ([]float64, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, errInvalidWAV
+	}
+
+	var (
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		pcm           []byte
+	)
+
+	// Обходим чанки файла
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		if size < 0 || body+size > len(data) {
+			return nil, 0, errInvalidWAV
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, errInvalidWAV
+			}
+			format := binary.LittleEndian.Uint16(data[body : body+2])
+			if format != 1 {
+				return nil, 0, fmt.Errorf("captcha: unsupported WAV format %d, only PCM is supported", format)
+			}
+			channels = int(binary.LittleEndian.Uint16(data[body+2 : body+4]))
+			sampleRate = int(binary.LittleEndian.Uint32(data[body+4 : body+8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(data[body+14 : body+16]))
+		case "data":
+			pcm = data[body : body+size]
+		}
+
+		// Чанки выравниваются по четной границе
+		pos = body + size + size%2
+	}
+
+	if channels == 0 || sampleRate == 0 || pcm == nil {
+		return nil, 0, errInvalidWAV
+	}
+	if bitsPerSample != 8 && bitsPerSample != 16 {
+		return nil, 0, fmt.Errorf("captcha: unsupported WAV bit depth %d", bitsPerSample)
+	}
+
+	bytesPerSample := bitsPerSample / 8
+	frameSize := bytesPerSample * channels
+	frames := len(pcm) / frameSize
+	samples := make([]float64, frames)
+
+	// Сводим все каналы в моно
+	for i := 0; i < frames; i++ {
+		sum := 0.0
+		for ch := 0; ch < channels; ch++ {
+			offset := i*frameSize + ch*bytesPerSample
+			if bitsPerSample == 8 {
+				sum += (float64(pcm[offset]) - 128) / 128
+			} else {
+				sum += float64(int16(binary.LittleEndian.Uint16(pcm[offset:]))) / 32768
+			}
+		}
+		samples[i] = sum / float64(channels)
+	}
+
+	return samples, sampleRate, nil
+}
+
+// encodeWAV кодирует моно-сэмплы в 16-битный PCM WAV
+func encodeWAV(samples []float64, sampleRate int) []byte {
+	dataSize := len(samples) * 2
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // моно
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	for _, s := range samples {
+		s = math.Max(-1, math.Min(1, s))
+		binary.Write(&buf, binary.LittleEndian, int16(s*32767))
+	}
+
+	return buf.Bytes()
+}
+
+// resample изменяет длину сигнала в factor раз с линейной интерполяцией
+func resample(samples []float64, factor float64) []float64 {
+	if len(samples) == 0 || factor <= 0 {
+		return nil
+	}
+
+	n := int(float64(len(samples)) * factor)
+	out := make([]float64, n)
+	for i := range out {
+		src := float64(i) / factor
+		i0 := int(src)
+		if i0 >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		t := src - float64(i0)
+		out[i] = samples[i0]*(1-t) + samples[i0+1]*t
+	}
+	return out
+}
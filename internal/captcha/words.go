@@ -0,0 +1,93 @@
+package captcha
+
+import (
+	"math/rand"
+	"strings"
+	"unicode"
+)
+
+// WordCaptchaConfig задает параметры капчи из слов
+type WordCaptchaConfig struct {
+	Words []string // Словарь (по умолчанию DefaultWords)
+	Count int      // Количество слов в капче (по умолчанию 2)
+}
+
+const defaultWordCount = 2
+
+// DefaultWords — короткие английские слова без легко путаемых букв (O/I/L)
+var DefaultWords = []string{
+	"ACE", "ART", "BAG", "BAT", "BED", "BEE", "BUS", "CAB", "CAKE", "CAP",
+	"CAR", "CAT", "CUP", "DAY", "DESK", "DEW", "DUCK", "EAR", "EGG", "FAN",
+	"FERN", "FEW", "FUN", "GAME", "GAS", "GEM", "HAT", "HEN", "HUT", "JAM",
+	"JAR", "JET", "KEY", "KEG", "MAP", "MAT", "MAZE", "NET", "NEST", "NUT",
+	"PAN", "PEN", "PET", "RAT", "RED", "RUG", "SAND", "SEA", "SKY", "SUN",
+	"TUBE", "TEA", "TEN", "TREE", "VAN", "WAVE", "WEB", "WEST", "YAK", "ZEBRA",
+}
+
+// WordCaptcha показывает несколько случайных слов из словаря,
+// отрисованных через ImageCaptcha. Слова разделяются пробелом,
+// на высоких изображениях каждое слово занимает свою строку
+type WordCaptcha struct {
+	image *ImageCaptcha
+	words []string
+	count int
+}
+
+func NewWordCaptcha(image *ImageCaptcha, config WordCaptchaConfig) *WordCaptcha {
+	c := &WordCaptcha{
+		image: image,
+		count: config.Count,
+	}
+
+	if c.count <= 0 {
+		c.count = defaultWordCount
+	}
+
+	// Оставляем только непустые слова без пробелов внутри
+	for _, word := range config.Words {
+		word = strings.TrimSpace(word)
+		if word != "" && !strings.ContainsFunc(word, unicode.IsSpace) {
+			c.words = append(c.words, word)
+		}
+	}
+	if len(c.words) == 0 {
+		c.words = DefaultWords
+	}
+
+	return c
+}
+
+// Generate отрисовывает переданный текст
+func (c *WordCaptcha) Generate(text string) ([]byte, error) {
+	return c.image.Generate(text)
+}
+
+// NewChallenge выбирает случайные слова и возвращает изображение и ожидаемый ответ
+func (c *WordCaptcha) NewChallenge() (image []byte, answer string, err error) {
+	answer = c.Phrase()
+	image, err = c.Generate(answer)
+	if err != nil {
+		return nil, "", err
+	}
+	return image, answer, nil
+}
+
+// Phrase возвращает Count случайных слов словаря через пробел.
+// Если слов в словаре хватает, они не повторяются
+func (c *WordCaptcha) Phrase() string {
+
+	order := rand.Perm(len(c.words))
+	words := make([]string, c.count)
+	for i := range words {
+		words[i] = c.words[order[i%len(order)]]
+	}
+	return strings.Join(words, " ")
+}
+
+// VerifyWords сравнивает ответ пользователя с ожидаемым без учета
+// регистра и количества пробелов между словами
+func VerifyWords(answer, input string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(answer), " "), strings.Join(strings.Fields(input), " "))
+}
+
+var _ Captcha = (*WordCaptcha)(nil)